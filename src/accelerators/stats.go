@@ -0,0 +1,36 @@
+package accelerators
+
+/* shape of a tree : interior nodes, leaves (a triangle each), empty subtrees,
+   and the depth of the leaves, the root being at depth 0 */
+type Stats struct {
+	Nodes, Leaves, Empty int
+	MaxDepth int
+	MeanDepth float64
+}
+
+func TreeStats(t Tree) Stats {
+	var s Stats
+	depths := 0
+	var walk func(t Tree, depth int)
+	walk = func(t Tree, depth int) {
+		switch n := t.(type) {
+		case *Node:
+			s.Nodes++
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		case *Element:
+			s.Leaves++
+			depths += depth
+			if depth > s.MaxDepth {
+				s.MaxDepth = depth
+			}
+		default:
+			s.Empty++
+		}
+	}
+	walk(t, 0)
+	if s.Leaves > 0 {
+		s.MeanDepth = float64(depths) / float64(s.Leaves)
+	}
+	return s
+}
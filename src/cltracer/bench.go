@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	mrand "math/rand"
+	"time"
+)
+
+/* cltracer bench -f scene : time to load the scene and build its tree, camera rays per second
+   through the accelerator, paths per second through the integrator. One worker, fixed seed */
+func bench(args []string) int {
+	flags := newFlagSet("bench", "-f scene [flags]", "Times the loading of the scene, the accelerator (camera rays) and the path tracer (full paths), on one worker.")
+	file := flags.String("f", "", "File to parse")
+	rays := flags.Int("rays", 1000000, "Number of camera rays intersected with the scene.")
+	paths := flags.Int("paths", 100000, "Number of paths traced.")
+	lightsFlag := flags.String("lights", "tree", "Emitter selection of the paths : tree (light BVH) or power.")
+	spectral := flags.Bool("spectral", false, "Trace spectral paths.")
+	seed := flags.Int64("seed", 1, "Seed of the random numbers, the same seed traces the same rays.")
+	if ok, code := parseFlags(flags, args); !ok {
+		return code
+	}
+	if *file == "" {
+		return usageError("No file to parse. Please provide a file to parse")
+	}
+	lightSampling, ok := lightSamplings[*lightsFlag]
+	if !ok {
+		return usageError("Unknown light sampling :", *lightsFlag)
+	}
+	if *rays < 0 || *paths < 0 {
+		return usageError("Negative number of rays or paths")
+	}
+	
+	start := time.Now()
+	scene := loadScene(*file)
+	if scene == nil {
+		return exitFailure
+	}
+	load := time.Since(start)
+	scene.Opts().SetLightSampling(lightSampling)
+	scene.Opts().SetSpectral(*spectral)
+	mrand.Seed(*seed)
+	
+	fmt.Printf("load   %10.3f ms\n", load.Seconds()*1000)
+	
+	start = time.Now()
+	hits := scene.TraceRays(*rays)
+	elapsed := time.Since(start)
+	fmt.Printf("rays   %10d in %8.3f s, %12.0f rays/s, %5.1f%% hit\n", *rays, elapsed.Seconds(), perSecond(*rays, elapsed), percent(hits, *rays))
+	
+	start = time.Now()
+	mean := scene.TracePaths(*paths)
+	elapsed = time.Since(start)
+	fmt.Printf("paths  %10d in %8.3f s, %12.0f paths/s, mean luminance %.4g\n", *paths, elapsed.Seconds(), perSecond(*paths, elapsed), mean)
+	return exitOK
+}
+
+func perSecond(n int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+func percent(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
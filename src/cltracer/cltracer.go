@@ -1,44 +1,125 @@
 package main
 
 import (
+	"core"
 	"flag"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"util"
-	"time"
-	mrand "math/rand"
-//	"regexp"
-//	"strconv"
 )
 
-const APP_VERSION = "0.3"
+const APP_VERSION = "0.4"
 
-// The flag package provides a default help printer via -h switch
-var versionFlag *bool = flag.Bool("v", false, "Print the version number.")
+/* exit codes of every command : scripts tell a failed run from a mistyped one */
+const (
+	exitOK = 0
+	/* the command ran and failed : unreadable input, invalid scene, images too different... */
+	exitFailure = 1
+	exitUsage = 2
+)
 
-var fileToParse *string = flag.String("f", "", "File to parse")
+type command struct {
+	summary string
+	run func(args []string) int
+}
 
-func main() {
-	flag.Parse() // Scan the arguments list
+var commands = map[string]command{
+	"render": {"render a scene to result.png (or .exr), the default command", render},
+	"info": {"print what a scene is made of, and what looks wrong with it", info},
+	"validate": {"check a scene, exit 1 when anything looks wrong", validate},
+	"convert": {"convert a scene to Wavefront OBJ, or an OBJ file to a scene", convert},
+	"bench": {"time the accelerator and the path tracer on a scene", bench},
+	"diff": {"compare two images", diff},
+}
 
-	if *versionFlag {
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage : cltracer <command> [flags], cltracer <command> -h for its flags")
+	fmt.Fprintln(os.Stderr, "        cltracer -f scene [flags] renders, as cltracer render does")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _,name := range names {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", name, commands[name].summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	name, args := os.Args[1], os.Args[2:]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		usage()
+		os.Exit(exitOK)
+	case "version", "-v":
 		fmt.Println("Version:", APP_VERSION)
+		os.Exit(exitOK)
+	}
+	c, ok := commands[name]
+	if !ok {
+		if !strings.HasPrefix(name, "-") {
+			fmt.Fprintln(os.Stderr, "Unknown command :", name)
+			usage()
+			os.Exit(exitUsage)
+		}
+		/* flags alone : the render command line of the previous versions */
+		c, args = commands["render"], os.Args[1:]
+	}
+	os.Exit(c.run(args))
+}
+
+/* flags of a command, with a usage line before their help */
+func newFlagSet(name string, arguments string, summary string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage : cltracer %s %s\n%s\n", name, arguments, summary)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+/* ok is false when the command should stop, with code as its exit code
+   (0 when the help was asked for) */
+func parseFlags(flags *flag.FlagSet, args []string) (ok bool, code int) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return false, exitOK
+		}
+		return false, exitUsage
+	}
+	return true, exitOK
+}
+
+/* the scene of the file, nil after telling why there is none */
+func loadScene(file string) *core.Scene {
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "No file to parse. Please provide a file to parse")
+		return nil
 	}
-	
-	if *fileToParse == "" {
-		fmt.Println("No file to parse. Please provide a file to parse")
-		return
-	}
-	
-	content := util.Parse(*fileToParse)
-	
-	scene := util.ParseFile(content)
-	
-	today := time.Now()
-	epoc := today.Unix()
-	
-	mrand.Seed(epoc)
-	
-	scene.Render(epoc)
-	
-	fmt.Println("Fin")
+	if _, err := os.Stat(file); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil
+	}
+	scene, err := util.ParseFile(util.Parse(file))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s : %v\n", file, err)
+		return nil
+	}
+	return scene
+}
+
+func fail(a ...interface{}) int {
+	fmt.Fprintln(os.Stderr, a...)
+	return exitFailure
+}
+
+func usageError(a ...interface{}) int {
+	fmt.Fprintln(os.Stderr, a...)
+	return exitUsage
 }
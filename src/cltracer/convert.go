@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"util"
+)
+
+/* cltracer convert -f input -o output : scene to OBJ when the output ends with .obj,
+   OBJ to scene when the input does */
+func convert(args []string) int {
+	flags := newFlagSet("convert", "-f input -o output", "Converts a scene to a Wavefront OBJ file and its material library (output ending with .obj),\nor an OBJ file to a scene (input ending with .obj).")
+	input := flags.String("f", "", "File to convert")
+	output := flags.String("o", "", "File written")
+	iterations := flags.Int("iterations", 16, "OBJ to scene : samples per pixel of the scene.")
+	size := flags.String("size", "256x256", "OBJ to scene : image size of the scene, widthxheight.")
+	if ok, code := parseFlags(flags, args); !ok {
+		return code
+	}
+	if *input == "" || *output == "" {
+		return usageError("convert needs an input (-f) and an output (-o)")
+	}
+	
+	fromOBJ := strings.EqualFold(filepath.Ext(*input), ".obj")
+	toOBJ := strings.EqualFold(filepath.Ext(*output), ".obj")
+	switch {
+	case fromOBJ && !toOBJ:
+		var width, height int
+		if n, _ := fmt.Sscanf(*size, "%dx%d", &width, &height); n != 2 || width <= 0 || height <= 0 {
+			return usageError("Invalid image size :", *size)
+		}
+		scene, err := util.OBJToScene(*input, *iterations, width, height)
+		if err != nil {
+			return fail(err)
+		}
+		f, err := os.Create(*output)
+		if err != nil {
+			return fail(err)
+		}
+		_, err = f.WriteString(scene)
+		/* a full disk can show up on close only */
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fail(err)
+		}
+	case toOBJ && !fromOBJ:
+		scene := loadScene(*input)
+		if scene == nil {
+			return exitFailure
+		}
+		warnings, err := util.WriteOBJ(scene, *output)
+		if err != nil {
+			return fail(err)
+		}
+		for _,w := range warnings {
+			fmt.Fprintln(os.Stderr, "Warning :", w)
+		}
+	default:
+		return usageError("One of the input and the output must be a .obj file, not both")
+	}
+	return exitOK
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"util"
+)
+
+/* cltracer diff a.png b.png : 0 when the images match within the threshold, 1 otherwise */
+func diff(args []string) int {
+	flags := newFlagSet("diff", "[flags] a.png b.png", "Compares two PNG or JPEG images of the same size, exits with 1 when their RMSE is over the threshold or their sizes differ.")
+	threshold := flags.Float64("threshold", 0, "Largest RMSE, on 0-255 channels, of matching images.")
+	tolerance := flags.Float64("tolerance", 0, "Channel difference, on 0-255, under which a pixel isn't counted as differing.")
+	heatmap := flags.String("o", "", "PNG written with the per pixel difference, black where the images match.")
+	if ok, code := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() != 2 {
+		return usageError("diff needs two images")
+	}
+	
+	a := util.LoadImage(flags.Arg(0))
+	if a == nil {
+		return fail("Can't read", flags.Arg(0))
+	}
+	b := util.LoadImage(flags.Arg(1))
+	if b == nil {
+		return fail("Can't read", flags.Arg(1))
+	}
+	d, err := util.CompareImages(a, b, *tolerance)
+	if err != nil {
+		return fail(err)
+	}
+	
+	fmt.Printf("rmse %.4f\npsnr %.2f dB\nmax %g\ndiffering %d of %d pixels (%.2f%%)\n", d.RMSE, d.PSNR, d.Max, d.Differing, d.Pixels, percent(d.Differing, d.Pixels))
+	
+	if *heatmap != "" {
+		f, err := os.Create(*heatmap)
+		if err != nil {
+			return fail(err)
+		}
+		err = png.Encode(f, d.Heatmap)
+		f.Close()
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if d.RMSE > *threshold {
+		return exitFailure
+	}
+	return exitOK
+}
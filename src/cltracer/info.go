@@ -0,0 +1,69 @@
+package main
+
+import (
+	"core"
+	"fmt"
+	"os"
+	"runtime"
+	"util"
+)
+
+/* cltracer info -f scene... : what the parser loaded, and what looks wrong with it */
+func info(args []string) int {
+	flags := newFlagSet("info", "-f scene [-f scene...]", "Prints the statistics of the scenes, their tree and their lights, then the warnings of validate.")
+	var files fileList
+	flags.Var(&files, "f", "File to parse, may be repeated")
+	if ok, code := parseFlags(flags, args); !ok {
+		return code
+	}
+	files = append(files, flags.Args()...)
+	if len(files) == 0 {
+		return usageError("No file to parse. Please provide a file to parse")
+	}
+	
+	code := exitOK
+	for _,file := range files {
+		scene := loadScene(file)
+		if scene == nil {
+			code = exitFailure
+			continue
+		}
+		printInfo(file, scene)
+	}
+	return code
+}
+
+/* statistics of one scene on stdout, its warnings on stderr */
+func printInfo(file string, scene *core.Scene) {
+	s := scene.Info()
+	box := scene.Enveloppe()
+	var memory runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&memory)
+	
+	fmt.Println("Scene", file)
+	fmt.Printf("  triangles     : %d, %d of them emitting\n", s.Triangles, s.Emitters)
+	fmt.Printf("  other lights  : %d\n", s.Lights)
+	fmt.Printf("  named views   : %d\n", s.Views)
+	fmt.Printf("  bounds        : (%g %g %g) - (%g %g %g)\n", box.GetLowerFromAxis(0), box.GetLowerFromAxis(1), box.GetLowerFromAxis(2),
+		box.GetUpperFromAxis(0), box.GetUpperFromAxis(1), box.GetUpperFromAxis(2))
+	fmt.Printf("  tree          : %d nodes, %d leaves, %d empty, depth %d max %.1f mean\n", s.Tree.Nodes, s.Tree.Leaves, s.Tree.Empty, s.Tree.MaxDepth, s.Tree.MeanDepth)
+	if s.Animated > 0 {
+		fmt.Printf("  animated tree : %d nodes, %d leaves, %d empty, depth %d max %.1f mean, rebuilt every frame\n", s.AnimatedTree.Nodes, s.AnimatedTree.Leaves, s.AnimatedTree.Empty, s.AnimatedTree.MaxDepth, s.AnimatedTree.MeanDepth)
+	}
+	fmt.Printf("  emitted power : %.4g\n", s.Power)
+	fmt.Printf("  memory        : %.1f MiB in use\n", float64(memory.HeapAlloc)/(1<<20))
+	
+	for _,w := range sceneWarnings(scene) {
+		fmt.Fprintf(os.Stderr, "Warning : %s : %s\n", file, w)
+	}
+}
+
+/* everything the validators find wrong with the scene */
+func sceneWarnings(scene *core.Scene) []string {
+	var warnings []string
+	warnings = append(warnings, util.ValidateGeometry(scene.Primitives())...)
+	warnings = append(warnings, util.ValidateEmitters(scene.Primitives())...)
+	warnings = append(warnings, util.ValidateCameras(scene)...)
+	return warnings
+}
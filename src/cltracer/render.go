@@ -0,0 +1,233 @@
+package main
+
+import (
+	"core"
+	"exr"
+	"fmt"
+	"geometry"
+	mrand "math/rand"
+	"os"
+	"strings"
+	"time"
+	"util"
+)
+
+/* cltracer render -f scene [flags] */
+func render(args []string) int {
+	flags := newFlagSet("render", "-f scene [flags]", "Renders the scene to result.png, or the path given by -o.")
+	versionFlag := flags.Bool("v", false, "Print the version number.")
+	fileToParse := flags.String("f", "", "File to parse")
+	outputFlag := flags.String("o", "result", "Output path without extension, views, frames and AOVs append to it.")
+	adaptiveFlag := flags.Bool("adaptive", false, "Sample adaptively, driven by the per-pixel variance.")
+	thresholdFlag := flags.Float64("threshold", 0.05, "Adaptive sampling : target relative error of a pixel.")
+	budgetFlag := flags.Int64("budget", 0, "Adaptive sampling : total number of samples (0 = iterations per pixel).")
+	tileFlag := flags.Int64("tile", 1, "Adaptive sampling : size in pixels of the tiles refined together.")
+	misFlag := flags.String("mis", "power", "Heuristic combining BSDF and light sampling : power or balance.")
+	lightsFlag := flags.String("lights", "tree", "Emitter selection : tree (light BVH) or power.")
+	spectralFlag := flags.Bool("spectral", false, "Render spectrally, with hero wavelength sampling.")
+	workingFlag := flags.String("working", "srgb", "Working color space of the scene colors : srgb (linear Rec.709) or acescg.")
+	displayFlag := flags.String("display", "srgb", "Color space of the output image : srgb, p3 or rec2020.")
+	whiteBalanceFlag := flags.Float64("wb", 0, "White balance : temperature in kelvins of the light rendered neutral (0 = none).")
+	aovFlag := flags.String("aov", "", "Comma separated buffers written beside the image : albedo, normal, depth, triangle, object, direct, indirect, emission or all.")
+	formatFlag := flags.String("format", "png", "Output file : png, or exr for an OpenEXR file holding the AOVs as layers.")
+	exrTypeFlag := flags.String("exrtype", "half", "OpenEXR pixel type : half or float.")
+	exrCompressionFlag := flags.String("exrcompression", "zip", "OpenEXR compression : none, zips (one scanline blocks) or zip.")
+	exrTileFlag := flags.Int64("exrtile", 0, "OpenEXR tile size, 0 for scanlines.")
+	denoiseFlag := flags.Bool("denoise", false, "Filter the image with the albedo, normal and depth buffers before tone mapping.")
+	filterFlag := flags.String("filter", "box", "Pixel reconstruction filter : box, tent, gaussian, mitchell or lanczos.")
+	filterRadiusFlag := flags.Float64("filterradius", 0, "Radius of the reconstruction filter in pixels (0 = the filter's default).")
+	cropFlag := flags.String("crop", "", "Region rendered, x0,y0,x1,y1 in pixels (x1 and y1 excluded), or fractions of the image when they all are within [0,1] and one has a decimal point.")
+	compositeFlag := flags.String("composite", "", "Full size PNG the cropped region is pasted into, instead of writing it alone.")
+	framesFlag := flags.String("frames", "", "Frame range first-last of an animated scene, rendered to result_<frame>.png.")
+	shutterFlag := flags.String("shutter", "", "Shutter interval open,close in frames around the frame rendered (e.g. -0.25,0.25), for motion blur.")
+	viewsFlag := flags.String("views", "", "Comma separated named views to render, to result_<view>.png, or all.")
+	if ok, code := parseFlags(flags, args); !ok {
+		return code
+	}
+	
+	if *versionFlag {
+		fmt.Println("Version:", APP_VERSION)
+	}
+	
+	if *fileToParse == "" {
+		return usageError("No file to parse. Please provide a file to parse")
+	}
+	
+	/* every flag is checked before the scene is loaded : a mistyped command line exits with
+	   exitUsage whatever the scene */
+	heuristic, ok := heuristics[*misFlag]
+	if !ok {
+		return usageError("Unknown MIS heuristic :", *misFlag)
+	}
+	
+	lightSampling, ok := lightSamplings[*lightsFlag]
+	if !ok {
+		return usageError("Unknown light sampling :", *lightsFlag)
+	}
+	
+	working := geometry.WorkingSpaceByName(*workingFlag)
+	display := geometry.DisplaySpaceByName(*displayFlag)
+	if working == nil || display == nil {
+		return usageError("Unknown color space :", *workingFlag, *displayFlag)
+	}
+	
+	aovs := 0
+	if *aovFlag != "" {
+		for _,name := range strings.Split(*aovFlag, ",") {
+			bit := core.AOVByName(strings.TrimSpace(name))
+			if bit == 0 {
+				return usageError("Unknown AOV :", name)
+			}
+			aovs |= bit
+		}
+	}
+	
+	if *formatFlag != "png" && *formatFlag != "exr" {
+		return usageError("Unknown output format :", *formatFlag)
+	}
+	pixelType, ok := exrPixelTypes[*exrTypeFlag]
+	if !ok {
+		return usageError("Unknown OpenEXR pixel type :", *exrTypeFlag)
+	}
+	compression, ok := exrCompressions[*exrCompressionFlag]
+	if !ok {
+		return usageError("Unknown OpenEXR compression :", *exrCompressionFlag)
+	}
+	if *exrTileFlag < 0 {
+		return usageError("Negative OpenEXR tile size :", *exrTileFlag)
+	}
+	
+	filter := core.FilterByName(*filterFlag, *filterRadiusFlag)
+	if filter == nil {
+		return usageError("Unknown filter :", *filterFlag)
+	}
+	
+	var open, close float64
+	if *shutterFlag != "" {
+		if n, _ := fmt.Sscanf(*shutterFlag, "%g,%g", &open, &close); n != 2 || close < open {
+			return usageError("Invalid shutter interval :", *shutterFlag)
+		}
+	}
+	
+	frames := []int{}
+	if *framesFlag != "" {
+		var first, last int
+		if n, _ := fmt.Sscanf(*framesFlag, "%d-%d", &first, &last); n != 2 || last < first {
+			return usageError("Invalid frame range :", *framesFlag)
+		}
+		for frame := first; frame <= last; frame++ {
+			frames = append(frames, frame)
+		}
+	}
+	
+	if *compositeFlag != "" && *cropFlag == "" {
+		return usageError("-composite needs a -crop window")
+	}
+	
+	scene := loadScene(*fileToParse)
+	if scene == nil {
+		return exitFailure
+	}
+	
+	for _,w := range util.ValidateEmitters(scene.Primitives()) {
+		fmt.Fprintln(os.Stderr, "Warning :", w)
+	}
+	
+	scene.Opts().SetHeuristic(heuristic)
+	scene.Opts().SetLightSampling(lightSampling)
+	scene.Opts().SetColorManagement(working, display, *whiteBalanceFlag)
+	scene.Opts().SetAOVs(aovs)
+	if *formatFlag == "exr" {
+		scene.Opts().SetEXR(pixelType, compression, int(*exrTileFlag))
+	}
+	scene.Opts().SetSpectral(*spectralFlag)
+	
+	if *cropFlag != "" {
+		width, height := scene.Opts().Size()
+		window, err := util.ParseCropWindow(*cropFlag, width, height)
+		if err == nil {
+			err = scene.Opts().SetCrop(window)
+		}
+		if err != nil {
+			return usageError("Invalid crop window :", err)
+		}
+		if *compositeFlag != "" {
+			if err := scene.Opts().SetComposite(*compositeFlag); err != nil {
+				return fail("Can't composite :", err)
+			}
+		}
+	}
+	
+	scene.Opts().SetFilter(filter)
+	scene.Opts().SetDenoise(*denoiseFlag)
+	
+	if *adaptiveFlag {
+		scene.Opts().SetAdaptive(*thresholdFlag, *budgetFlag, *tileFlag)
+	}
+	
+	if *shutterFlag != "" {
+		scene.Opts().SetShutter(open, close)
+	}
+	
+	today := time.Now()
+	epoc := today.Unix()
+	
+	mrand.Seed(epoc)
+	
+	/* the whole selection is checked before the first image is rendered */
+	views := []string{""}
+	if *viewsFlag == "all" {
+		views = scene.Views()
+		if len(views) == 0 {
+			return usageError("-views all : the scene has no named view")
+		}
+	} else if *viewsFlag != "" {
+		views = strings.Split(*viewsFlag, ",")
+		known := make(map[string]bool)
+		for _,view := range scene.Views() {
+			known[view] = true
+		}
+		for i := range views {
+			views[i] = strings.TrimSpace(views[i])
+			if !known[views[i]] {
+				return usageError("Unknown view :", views[i])
+			}
+		}
+	}
+	
+	for _, view := range views {
+		if err := scene.SetView(view); err != nil {
+			return usageError(err)
+		}
+		output := *outputFlag
+		if view != "" {
+			output += "_" + view
+		}
+		if len(frames) == 0 {
+			scene.Opts().SetOutput(output)
+			if err := scene.Render(epoc); err != nil {
+				return fail("Can't write the image :", err)
+			}
+			continue
+		}
+		for _, frame := range frames {
+			scene.SetFrame(float64(frame))
+			scene.Opts().SetOutput(fmt.Sprintf("%s_%04d", output, frame))
+			if err := scene.Render(epoc); err != nil {
+				return fail("Can't write the image :", err)
+			}
+			fmt.Fprintln(os.Stderr, "Frame", frame, view)
+		}
+	}
+	
+	return exitOK
+}
+
+/* values of the enumerated flags, any other value is a usage error */
+var heuristics = map[string]int{"power": core.PowerHeuristic, "balance": core.BalanceHeuristic}
+
+var lightSamplings = map[string]int{"tree": core.TreeLightSampling, "power": core.PowerLightSampling}
+
+var exrPixelTypes = map[string]int{"half": exr.Half, "float": exr.Float}
+
+var exrCompressions = map[string]int{"none": exr.NoCompression, "zips": exr.ZIPSCompression, "zip": exr.ZIPCompression}
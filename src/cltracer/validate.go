@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+)
+
+/* cltracer validate -f scene... : silent and 0 when every scene is fine,
+   the warnings and 1 otherwise, for build pipelines */
+func validate(args []string) int {
+	flags := newFlagSet("validate", "-f scene [-f scene...] [-q]", "Checks the geometry, emitters and cameras of the scenes, exits with 1 when anything looks wrong.")
+	var files fileList
+	flags.Var(&files, "f", "File to parse, may be repeated")
+	quiet := flags.Bool("q", false, "Print nothing, only set the exit code.")
+	if ok, code := parseFlags(flags, args); !ok {
+		return code
+	}
+	files = append(files, flags.Args()...)
+	if len(files) == 0 {
+		return usageError("No file to parse. Please provide a file to parse")
+	}
+	
+	code := exitOK
+	for _,file := range files {
+		scene := loadScene(file)
+		if scene == nil {
+			code = exitFailure
+			continue
+		}
+		warnings := sceneWarnings(scene)
+		if len(warnings) > 0 {
+			code = exitFailure
+		}
+		if *quiet {
+			continue
+		}
+		for _,w := range warnings {
+			fmt.Printf("%s : %s\n", file, w)
+		}
+	}
+	return code
+}
+
+/* a flag given several times */
+type fileList []string
+
+func (l *fileList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *fileList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
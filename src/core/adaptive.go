@@ -0,0 +1,97 @@
+package core
+
+import (
+	"math"
+	"sort"
+)
+
+const renderWorkers int = 4
+
+/* samples per pixel of the first adaptive pass, and of every following pass on a noisy tile */
+const adaptiveBatch int = 4
+
+type tile struct {
+	x0, y0, x1, y1 int
+	err float64
+}
+
+func allPixels(film *Film) []int {
+	pixels := make([]int, film.width*film.height)
+	for i := range pixels {
+		pixels[i] = i
+	}
+	return pixels
+}
+
+func makeTiles(film *Film, size int) []*tile {
+	var tiles []*tile
+	for y := 0; y < film.height ; y += size {
+		for x := 0; x < film.width ; x += size {
+			t := &tile{x, y, int(math.Min(float64(x+size), float64(film.width))), int(math.Min(float64(y+size), float64(film.height))), math.Inf(1)}
+			tiles = append(tiles, t)
+		}
+	}
+	return tiles
+}
+
+/* a tile is as noisy as its worst pixel */
+func (t *tile) update(film *Film) {
+	t.err = 0
+	for y := t.y0; y < t.y1 ; y++ {
+		for x := t.x0; x < t.x1 ; x++ {
+			t.err = math.Max(t.err, film.RelativeError(x, y))
+		}
+	}
+}
+
+func (t *tile) pixels(film *Film) []int {
+	var pixels []int
+	for y := t.y0; y < t.y1 ; y++ {
+		for x := t.x0; x < t.x1 ; x++ {
+			pixels = append(pixels, x+(film.width*y))
+		}
+	}
+	return pixels
+}
+
+/* spends the sample budget where the estimated error is the highest :
+   every pass samples the noisiest tiles above the threshold, worst first,
+   until no tile is above the threshold or the budget is spent */
+func (scene *Scene) renderAdaptive(film *Film) {
+	budget := scene.opts.budget
+	if budget <= 0 {
+		budget = scene.opts.iterations * film.width * film.height
+	}
+
+	spent := 0
+	tiles := makeTiles(film, scene.opts.tileSize)
+
+	for spent < budget {
+		var active []*tile
+		for _, t := range tiles {
+			if t.err > scene.opts.threshold {
+				active = append(active, t)
+			}
+		}
+		if len(active) == 0 {
+			break
+		}
+		sort.Slice(active, func(i, j int) bool { return active[i].err > active[j].err })
+
+		var pixels []int
+		for _, t := range active {
+			tp := t.pixels(film)
+			if spent + (len(pixels)+len(tp))*adaptiveBatch > budget && len(pixels) > 0 {
+				break
+			}
+			pixels = append(pixels, tp...)
+		}
+
+		scene.samplePixels(film, pixels, adaptiveBatch)
+		spent += len(pixels) * adaptiveBatch
+
+		for _, t := range active {
+			t.update(film)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	. "geometry"
+	"accelerators"
+	"sort"
+)
+
+const (
+	LinearInterpolation = iota
+	CatmullRomInterpolation
+)
+
+/* values of a track at a frame, interpolation is the one of the segment starting at the key */
+type key struct {
+	frame float64
+	values []float64
+	interpolation int
+}
+
+/* keyframes sorted by frame, held constant before the first and after the last */
+type track struct {
+	keys []key
+}
+
+func (t *track) add(frame float64, values []float64, interpolation int) {
+	t.keys = append(t.keys, key{frame, values, interpolation})
+	sort.SliceStable(t.keys, func(i, j int) bool { return t.keys[i].frame < t.keys[j].frame })
+}
+
+func (t *track) at(frame float64) []float64 {
+	n := len(t.keys)
+	if frame <= t.keys[0].frame {
+		return t.keys[0].values
+	}
+	if frame >= t.keys[n-1].frame {
+		return t.keys[n-1].values
+	}
+	i := sort.Search(n, func(i int) bool { return t.keys[i].frame > frame }) - 1
+	k0, k1 := &t.keys[i], &t.keys[i+1]
+	length := k1.frame - k0.frame
+	u := (frame - k0.frame) / length
+	
+	values := make([]float64, len(k0.values))
+	if k0.interpolation == LinearInterpolation {
+		for j := range values {
+			values[j] = (1-u)*k0.values[j] + u*k1.values[j]
+		}
+		return values
+	}
+	/* cubic Hermite with the Catmull-Rom tangents of the neighbouring keys,
+	   one-sided at the ends, in value per frame scaled to the segment */
+	m0, m1 := t.tangent(i), t.tangent(i+1)
+	u2, u3 := u*u, u*u*u
+	h00, h10, h01, h11 := 2*u3-3*u2+1, u3-2*u2+u, -2*u3+3*u2, u3-u2
+	for j := range values {
+		values[j] = h00*k0.values[j] + h10*length*m0[j] + h01*k1.values[j] + h11*length*m1[j]
+	}
+	return values
+}
+
+func (t *track) tangent(i int) []float64 {
+	prev, next := &t.keys[maxInt(i-1, 0)], &t.keys[minInt(i+1, len(t.keys)-1)]
+	m := make([]float64, len(prev.values))
+	for j := range m {
+		m[j] = (next.values[j] - prev.values[j]) / (next.frame - prev.frame)
+	}
+	return m
+}
+
+/* triangles moved together by a track of translation (3), rotation in degrees (3) and scale,
+   around pivot. rest holds their vertices as parsed */
+type animatedObject struct {
+	name string
+	triangles []*Triangle
+	rest [][3]Point3
+	pivot Point3
+	track track
+}
+
+/* keyframed camera and objects of a scene. Frames are numbers, keys may fall between them */
+type Animation struct {
+	camera track
+	objects []*animatedObject
+}
+
+func NewAnimation() *Animation {
+	return &Animation{}
+}
+
+func (a *Animation) AddCameraKey(frame float64, position Point3, direction Vector3, fov float64, interpolation int) {
+	a.camera.add(frame, []float64{position.X(), position.Y(), position.Z(), direction.X(), direction.Y(), direction.Z(), fov}, interpolation)
+}
+
+/* key of the object called name, made of those triangles : they rotate and scale around the
+   center of their bounds as parsed. The triangles are those given with the first key of the
+   object, and must not belong to another object */
+func (a *Animation) AddObjectKey(name string, triangles []*Triangle, frame float64, translation Vector3, rotation Vector3, scale float64, interpolation int) {
+	var object *animatedObject
+	for _, o := range a.objects {
+		if o.name == name {
+			object = o
+		}
+	}
+	if object == nil {
+		object = &animatedObject{name: name, triangles: triangles}
+		var bounds Expandable = &EmptyBBox{}
+		for _, t := range triangles {
+			object.rest = append(object.rest, t.Vertices())
+			box := t.Box()
+			bounds = ExpandBBox(bounds, &box)
+		}
+		if box, ok := bounds.(*BoundingBox); ok {
+			var c [3]float64
+			for axis := range c {
+				c[axis] = (box.GetLowerFromAxis(axis) + box.GetUpperFromAxis(axis)) / 2
+			}
+			object.pivot = *NewPoint(c[0], c[1], c[2])
+		}
+		a.objects = append(a.objects, object)
+	}
+	object.track.add(frame, []float64{translation.X(), translation.Y(), translation.Z(), rotation.X(), rotation.Y(), rotation.Z(), scale}, interpolation)
+}
+
+/* whether the triangle belongs to an animated object, and so stays out of the static tree */
+func (a *Animation) IsAnimated(t *Triangle) bool {
+	for _, o := range a.objects {
+		for _, ot := range o.triangles {
+			if ot == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *Animation) cameraAt(frame float64) *Camera {
+	v := a.camera.at(frame)
+	return NewCamera(*NewPoint(v[0], v[1], v[2]), *NewVector(v[3], v[4], v[5]), v[6])
+}
+
+func (o *animatedObject) transformAt(frame float64) *Transform {
+	v := o.track.at(frame)
+	return NewTransform(*NewVector(v[0], v[1], v[2]), *NewVector(v[3], v[4], v[5]), v[6], o.pivot)
+}
+
+/* places the triangles where they are at frame open, moving to where they are at frame close */
+func (o *animatedObject) moveTo(open float64, close float64) {
+	start := o.transformAt(open)
+	var end *Transform
+	if close != open {
+		end = o.transformAt(close)
+	}
+	for i, t := range o.triangles {
+		t.SetVertices(start.Point(o.rest[i][0]), start.Point(o.rest[i][1]), start.Point(o.rest[i][2]))
+		if end == nil {
+			t.SetMotion(nil)
+		} else {
+			t.SetMotion(&[3]Point3{end.Point(o.rest[i][0]), end.Point(o.rest[i][1]), end.Point(o.rest[i][2])})
+		}
+	}
+}
+
+/* the scene keeps its tree of static triangles for every frame */
+func (scene *Scene) SetAnimation(a *Animation) {
+	scene.animation = a
+	scene.staticEnveloppe = scene.enveloppe
+}
+
+/* frame Render draws, 0 unless set */
+func (scene *Scene) SetFrame(frame float64) {
+	scene.frame = frame
+}
+
+/* the camera at that instant of the shutter interval, from 0 at its opening to 1 at its closing */
+func (scene *Scene) cameraAt(time float64) *Camera {
+	a := scene.animation
+	if scene.view != nil || a == nil || len(a.camera.keys) == 0 {
+		return scene.currentCamera()
+	}
+	return a.cameraAt(scene.frame + scene.opts.shutterOpen + time*(scene.opts.shutterClose-scene.opts.shutterOpen))
+}
+
+/* puts the camera and the animated objects where they are at the frame, with a tree of their
+   own. With motion blur, objects are where they are when the shutter opens and move linearly
+   to where they are when it closes */
+func (scene *Scene) pose() {
+	a := scene.animation
+	if a == nil {
+		return
+	}
+	if len(a.camera.keys) > 0 {
+		scene.camera = a.cameraAt(scene.frame)
+	}
+	if len(a.objects) == 0 {
+		return
+	}
+	
+	blur := scene.opts.MotionBlur()
+	var tree accelerators.Tree = &accelerators.EmptyTree{}
+	var enveloppe Expandable = scene.staticEnveloppe
+	for _, o := range a.objects {
+		if blur {
+			o.moveTo(scene.frame + scene.opts.shutterOpen, scene.frame + scene.opts.shutterClose)
+		} else {
+			o.moveTo(scene.frame, scene.frame)
+		}
+		for _, t := range o.triangles {
+			tree = accelerators.Insert(tree, t)
+			box := t.Box()
+			enveloppe = ExpandBBox(enveloppe, &box)
+		}
+	}
+	scene.animatedTree = tree
+	scene.enveloppe = enveloppe.(*BoundingBox)
+	/* lights depending on the size of the scene */
+	for _, l := range scene.sources {
+		l.preprocess(scene.enveloppe)
+	}
+}
@@ -0,0 +1,337 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	. "geometry"
+	"image"
+	c "image/color"
+	png "image/png"
+	"math"
+	"os"
+	"sort"
+)
+
+/* arbitrary output variables, buffers filled beside the beauty image */
+const (
+	AOVAlbedo = 1 << iota
+	AOVNormal
+	AOVDepth
+	AOVTriangle
+	AOVObject
+	AOVDirect
+	AOVIndirect
+	AOVEmission
+)
+
+var aovNames = []string{"albedo", "normal", "depth", "triangle", "object", "direct", "indirect", "emission"}
+
+/* bit of the named AOV, 0 for an unknown name. "all" gives every AOV */
+func AOVByName(name string) int {
+	if name == "all" {
+		return 1<<uint(len(aovNames)) - 1
+	}
+	for i, n := range aovNames {
+		if n == name {
+			return 1 << uint(i)
+		}
+	}
+	return 0
+}
+
+const (
+	aovFirstSurface = iota
+	aovNextSurface
+	aovDone
+)
+
+/* what one camera path found : the first surface, the light it emits, the light it reflects
+   straight from the emitters (sampled, or found by its BSDF sample on the next surface) */
+type aovRecord struct {
+	stage int
+	hit bool
+	albedo Color
+	normal Vector3
+	depth float64
+	triangle *Triangle
+	emission, direct, nextEmission Color
+	/* position of the camera the path leaves from, for the depth */
+	eye Point3
+}
+
+/* the methods accept a nil record : paths without AOVs, and rays after the second */
+func (r *aovRecord) currentStage() int {
+	if r == nil {
+		return aovDone
+	}
+	return r.stage
+}
+
+func (r *aovRecord) finish() {
+	if r != nil {
+		r.stage = aovDone
+	}
+}
+
+func (r *aovRecord) firstSurface(sfp *SurfacePoint, emission *Color, direct *Color) {
+	toHit := NewVectorFromPoints(r.eye, *sfp.HitPosition())
+	r.hit = true
+	r.albedo = *sfp.Albedo()
+	r.normal = sfp.ShadingNormal()
+	r.depth = math.Sqrt(toHit.DotProduct(*toHit))
+	r.triangle = sfp.Object()
+	r.emission = *emission
+	r.direct = *direct
+	r.stage = aovNextSurface
+}
+
+/* emission seen by the current ray : by the camera, or after the first bounce */
+func (r *aovRecord) emitted(e *Color) {
+	switch r.currentStage() {
+	case aovFirstSurface:
+		r.emission = *e
+	case aovNextSurface:
+		r.nextEmission = *e
+	default:
+		return
+	}
+	r.stage = aovDone
+}
+
+/* emission found by the BSDF sample of the first surface, times its weight */
+func (r *aovRecord) bounced(weight *Color) {
+	if r != nil {
+		r.direct = *AddColor(r.direct, *ColorMultC(&r.nextEmission, weight))
+	}
+}
+
+/* the medium the ray crossed before reaching the stage it started at attenuates it */
+func (r *aovRecord) attenuate(stage int, weight *Color) {
+	switch stage {
+	case aovFirstSurface:
+		r.emission = *ColorMultC(&r.emission, weight)
+		r.direct = *ColorMultC(&r.direct, weight)
+	case aovNextSurface:
+		r.nextEmission = *ColorMultC(&r.nextEmission, weight)
+	}
+}
+
+/* per pixel buffers : sums over the samples (the indirect light is what the beauty has beyond
+   emission and direct light), depth and normal over the samples that hit a surface.
+   Identifiers are those of the first sample that hit something, -1 for none */
+type aovBuffers struct {
+	mask int
+	albedo, normal, emission, direct, indirect []Color
+	depth []float64
+	hits []int
+	triangle, object []int
+}
+
+func newAOVBuffers(mask int, size int) *aovBuffers {
+	b := &aovBuffers{mask: mask}
+	b.albedo = make([]Color, size)
+	b.normal = make([]Color, size)
+	b.emission = make([]Color, size)
+	b.direct = make([]Color, size)
+	b.indirect = make([]Color, size)
+	b.depth = make([]float64, size)
+	b.hits = make([]int, size)
+	b.triangle = make([]int, size)
+	b.object = make([]int, size)
+	for i := range b.triangle {
+		b.triangle[i] = -1
+		b.object[i] = -1
+	}
+	return b
+}
+
+func (b *aovBuffers) add(i int, r *aovRecord, beauty *Color, scene *Scene) {
+	b.emission[i] = *AddColor(b.emission[i], r.emission)
+	b.direct[i] = *AddColor(b.direct[i], r.direct)
+	indirect := AddColor(*beauty, *MultC(AddColor(r.emission, r.direct), -1))
+	b.indirect[i] = *AddColor(b.indirect[i], *indirect)
+	if !r.hit {
+		return
+	}
+	b.hits[i]++
+	b.albedo[i] = *AddColor(b.albedo[i], r.albedo)
+	b.normal[i] = *AddColor(b.normal[i], *NewColor(r.normal.X(), r.normal.Y(), r.normal.Z()))
+	b.depth[i] += r.depth
+	if b.triangle[i] < 0 {
+		b.triangle[i] = scene.triangleIndex[r.triangle]
+		b.object[i] = scene.objectIndex[r.triangle.Id()]
+	}
+}
+
+/* numbers the triangles in scene order and their names in alphabetical order */
+func (scene *Scene) indexPrimitives() {
+	scene.triangleIndex = make(map[*Triangle]int)
+	scene.objectIndex = make(map[string]int)
+	var names []string
+	for i, t := range scene.prims {
+		if t == nil {
+			continue
+		}
+		scene.triangleIndex[t] = i
+		if _, ok := scene.objectIndex[t.Id()]; !ok {
+			scene.objectIndex[t.Id()] = 0
+			names = append(names, t.Id())
+		}
+	}
+	sort.Strings(names)
+	for i, n := range names {
+		scene.objectIndex[n] = i
+	}
+	scene.objectNames = names
+}
+
+/* albedo of the pixel, averaged over the samples that hit a surface */
+func (f *Film) Albedo(x int, y int) *Color {
+	i := x + f.width*y
+	if f.aovs == nil || f.aovs.hits[i] == 0 {
+		return NewColor(0, 0, 0)
+	}
+	return MultC(&f.aovs.albedo[i], 1/float64(f.aovs.hits[i]))
+}
+
+/* mean shading normal of the pixel, not normalized */
+func (f *Film) Normal(x int, y int) *Color {
+	i := x + f.width*y
+	if f.aovs == nil || f.aovs.hits[i] == 0 {
+		return NewColor(0, 0, 0)
+	}
+	return MultC(&f.aovs.normal[i], 1/float64(f.aovs.hits[i]))
+}
+
+func (f *Film) Depth(x int, y int) float64 {
+	i := x + f.width*y
+	if f.aovs == nil || f.aovs.hits[i] == 0 {
+		return math.Inf(1)
+	}
+	return f.aovs.depth[i] / float64(f.aovs.hits[i])
+}
+
+/* light buffer of the pixel, averaged over every sample */
+func (f *Film) lighting(buffer []Color, x int, y int) *Color {
+	i := x + f.width*y
+	n := f.pixels[i].count
+	if n == 0 {
+		return NewColor(0, 0, 0)
+	}
+	return MultC(&buffer[i], 1/float64(n))
+}
+
+/* every enabled buffer as <output>_<name>.png : colors through the output transform, normals
+   as 0.5 + 0.5 n, depth as 16 bit gray (0 for no hit, hits scaled from 1 at the camera to 65535 at
+   the farthest hit), identifiers as 16 bit gray
+   (0 for no hit, index + 1 otherwise, clamped to 65535) with the object names in <output>_objects.txt */
+func (scene *Scene) writeAOVs(film *Film, output *ColorTransform) error {
+	b := film.aovs
+	w, h := film.width, film.height
+	for bit, name := range aovNames {
+		if b.mask&(1<<uint(bit)) == 0 {
+			continue
+		}
+		mask := 1 << uint(bit)
+		var img image.Image
+		switch mask {
+		case AOVAlbedo, AOVEmission, AOVDirect, AOVIndirect:
+			rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					var v *Color
+					switch mask {
+					case AOVAlbedo:
+						v = film.Albedo(x, y)
+					case AOVEmission:
+						v = film.lighting(b.emission, x, y)
+					case AOVDirect:
+						v = film.lighting(b.direct, x, y)
+					default:
+						v = film.lighting(b.indirect, x, y)
+					}
+					r, g, bl := output.Encode8(v)
+					rgba.Set(x, y, c.RGBA{r, g, bl, 255})
+				}
+			}
+			img = rgba
+		case AOVNormal:
+			rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					nx, ny, nz := film.Normal(x, y).RGB()
+					rgba.Set(x, y, c.RGBA{unitByte(nx), unitByte(ny), unitByte(nz), 255})
+				}
+			}
+			img = rgba
+		case AOVDepth:
+			farthest := 0.0
+			for i := range b.depth {
+				if d := film.Depth(i%w, i/w); !math.IsInf(d, 1) {
+					farthest = math.Max(farthest, d)
+				}
+			}
+			gray := image.NewGray16(image.Rect(0, 0, w, h))
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					d := film.Depth(x, y)
+					v := uint16(0)
+					if !math.IsInf(d, 1) {
+						v = 1
+						if farthest > 0 {
+							v += uint16(math.Round(d / farthest * 0xfffe))
+						}
+					}
+					gray.SetGray16(x, y, c.Gray16{v})
+				}
+			}
+			img = gray
+		default:
+			ids := b.triangle
+			if mask == AOVObject {
+				ids = b.object
+			}
+			gray := image.NewGray16(image.Rect(0, 0, w, h))
+			clamped := 0
+			for i, id := range ids {
+				if id+1 > math.MaxUint16 {
+					id = math.MaxUint16 - 1
+					clamped++
+				}
+				gray.SetGray16(i%w, i/w, c.Gray16{uint16(id + 1)})
+			}
+			if clamped > 0 {
+				fmt.Fprintf(os.Stderr, "Warning : %d pixels of the %s AOV have identifiers above %d, written as %d (the EXR output keeps them)\n", clamped, name, math.MaxUint16-1, math.MaxUint16)
+			}
+			img = gray
+		}
+		f, err := os.Create(scene.opts.output + "_" + name + ".png")
+		if err != nil {
+			return err
+		}
+		err = png.Encode(f, img)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	
+	if b.mask&AOVObject != 0 {
+		f, err := os.Create(scene.opts.output + "_objects.txt")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out := bufio.NewWriter(f)
+		for i, n := range scene.objectNames {
+			fmt.Fprintf(out, "%d %s\n", i+1, n)
+		}
+		return out.Flush()
+	}
+	return nil
+}
+
+/* [-1,1] to [0,255] */
+func unitByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Floor((0.5+0.5*v)*255+0.5))))
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	. "geometry"
+	mrand "math/rand"
+)
+
+/* traces n camera rays through random points of the image, one worker, and gives how many
+   hit a triangle : the cost of the accelerator alone */
+func (scene *Scene) TraceRays(n int) (hits int) {
+	scene.pose()
+	camera := scene.currentCamera()
+	for i := 0; i < n; i++ {
+		dir := scene.cameraRay(camera, mrand.Float64()*float64(scene.opts.imWidth), mrand.Float64()*float64(scene.opts.imHeight))
+		var hitObject *Triangle
+		var hitPosition *Point3
+		scene.intersection(&camera.position, dir, nil, 0, &hitObject, &hitPosition)
+		if hitObject != nil {
+			hits++
+		}
+	}
+	return
+}
+
+/* traces n full paths from the camera as Render does, one worker, without a film, and gives
+   the mean luminance they bring back */
+func (scene *Scene) TracePaths(n int) float64 {
+	scene.pose()
+	scene.prepare()
+	camera := scene.currentCamera()
+	sum := 0.0
+	for i := 0; i < n; i++ {
+		var wl *Wavelengths
+		if scene.opts.spectral {
+			wl = SampleWavelengths(mrand.Float64())
+		}
+		dir := scene.cameraRay(camera, mrand.Float64()*float64(scene.opts.imWidth), mrand.Float64()*float64(scene.opts.imHeight))
+		radiance := scene.getRadiance(&camera.position, &dir, nil, cameraEvent(nil), scene.medium, wl, 0)
+		sum += scene.toWorking(radiance, wl).Luminance()
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+)
+
+/* region of the image rendered, in pixels, x1 and y1 excluded */
+type CropWindow struct {
+	x0, y0, x1, y1 int
+}
+
+func NewCropWindow(x0 int, y0 int, x1 int, y1 int) *CropWindow {
+	return &CropWindow{x0, y0, x1, y1}
+}
+
+/* crop window of the fractions of the image width and height, the pixels the region touches */
+func NewNormalizedCropWindow(x0 float64, y0 float64, x1 float64, y1 float64, width int, height int) *CropWindow {
+	return &CropWindow{int(math.Floor(x0 * float64(width))), int(math.Floor(y0 * float64(height))),
+		int(math.Ceil(x1 * float64(width))), int(math.Ceil(y1 * float64(height)))}
+}
+
+func (w *CropWindow) Width() int {
+	return w.x1 - w.x0
+}
+
+func (w *CropWindow) Height() int {
+	return w.y1 - w.y0
+}
+
+/* the window clamped to an image of that size, nil if nothing of it is left */
+func (w *CropWindow) clamp(width int, height int) *CropWindow {
+	clamped := &CropWindow{maxInt(w.x0, 0), maxInt(w.y0, 0), minInt(w.x1, width), minInt(w.y1, height)}
+	if clamped.Width() <= 0 || clamped.Height() <= 0 {
+		return nil
+	}
+	return clamped
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+/* region rendered : the crop window, the whole image without one */
+func (scene *Scene) window() *CropWindow {
+	if scene.opts.crop != nil {
+		return scene.opts.crop
+	}
+	return &CropWindow{0, 0, scene.opts.imWidth, scene.opts.imHeight}
+}
+
+func (opts *SceneOpts) Size() (int, int) {
+	return opts.imWidth, opts.imHeight
+}
+
+/* bounds of the full image */
+func (opts *SceneOpts) imageBounds() image.Rectangle {
+	return image.Rect(0, 0, opts.imWidth, opts.imHeight)
+}
+
+/* renders only the window, clamped to the image */
+func (opts *SceneOpts) SetCrop(w *CropWindow) error {
+	clamped := w.clamp(opts.imWidth, opts.imHeight)
+	if clamped == nil {
+		return errors.New("crop window outside the image")
+	}
+	opts.crop = clamped
+	return nil
+}
+
+/* writes the cropped render pasted into the image of path, of the full size, instead of alone */
+func (opts *SceneOpts) SetComposite(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	base, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+	if base.Bounds() != opts.imageBounds() {
+		return errors.New(path + " isn't the size of the image")
+	}
+	opts.composite = base
+	return nil
+}
+
+/* the base image with the rendered region drawn over it */
+func (scene *Scene) compositeRegion(region image.Image) image.Image {
+	base := scene.opts.composite
+	full := image.NewRGBA(base.Bounds())
+	draw.Draw(full, full.Bounds(), base, base.Bounds().Min, draw.Src)
+	w := scene.window()
+	draw.Draw(full, region.Bounds().Add(image.Pt(w.x0, w.y0)), region, region.Bounds().Min, draw.Src)
+	return full
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	. "geometry"
+	"math"
+)
+
+/* edge-avoiding à-trous wavelet filter (SVGF, Schied et al.) : the irradiance, the image divided
+   by the albedo, is smoothed by a 5x5 B3 spline kernel spread by 2^i at the i-th pass, the weights
+   dropping across normal and depth discontinuities and across luminance differences larger than
+   the noise the film estimated for the pixel. The albedo is multiplied back at the end */
+const denoisePasses int = 5
+
+var atrousKernel = [3]float64{3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+const (
+	/* exponent of the cosine between the normals */
+	sigmaNormal float64 = 128
+	/* relative depth difference, per pass step */
+	sigmaDepth float64 = 0.02
+	/* luminance difference, in standard deviations of the pixel */
+	sigmaLuminance float64 = 4
+)
+
+/* albedo under which a channel isn't divided out */
+const minAlbedo float64 = 0.01
+
+type denoiseFeatures struct {
+	normal Vector3
+	depth float64
+	hit bool
+}
+
+/* replaces the estimate of every pixel by the filtered one, the film needs the AOV buffers */
+func (f *Film) Denoise() {
+	if f.aovs == nil {
+		return
+	}
+	n := f.width * f.height
+	irradiance := make([]Color, n)
+	variance := make([]float64, n)
+	albedo := make([]Color, n)
+	features := make([]denoiseFeatures, n)
+	
+	for i := 0; i < n; i++ {
+		x, y := i%f.width, i/f.width
+		a := f.Albedo(x, y)
+		r, g, b := a.RGB()
+		albedo[i] = *NewColor(demodulation(r), demodulation(g), demodulation(b))
+		mean := f.Filtered(x, y)
+		ar, ag, ab := albedo[i].RGB()
+		irradiance[i] = *ColorMultC(mean, NewColor(1/ar, 1/ag, 1/ab))
+		if count := f.Samples(x, y); count > 0 {
+			l := albedo[i].Luminance()
+			variance[i] = f.Variance(x, y) / float64(count) / (l * l)
+		}
+		if f.aovs.hits[i] > 0 {
+			nx, ny, nz := f.Normal(x, y).RGB()
+			normal := *NewVector(nx, ny, nz)
+			if !IsNillVector(normal) {
+				normal = UnitizeV(normal)
+			}
+			features[i] = denoiseFeatures{normal, f.Depth(x, y), true}
+		}
+	}
+	
+	for pass := 0; pass < denoisePasses; pass++ {
+		irradiance, variance = f.atrous(irradiance, variance, features, 1<<uint(pass))
+	}
+	
+	f.denoised = make([]Color, n)
+	for i := range f.denoised {
+		f.denoised[i] = *ColorMultC(&irradiance[i], &albedo[i])
+	}
+}
+
+func demodulation(a float64) float64 {
+	if a < minAlbedo {
+		return 1
+	}
+	return a
+}
+
+func (f *Film) atrous(irradiance []Color, variance []float64, features []denoiseFeatures, step int) ([]Color, []float64) {
+	filtered := make([]Color, len(irradiance))
+	filteredVariance := make([]float64, len(variance))
+	
+	for p := range irradiance {
+		px, py := p%f.width, p/f.width
+		fp := &features[p]
+		lp := irradiance[p].Luminance()
+		sigmaL := sigmaLuminance*math.Sqrt(math.Max(variance[p], 0)) + 1e-4
+		
+		sum := NewColor(0, 0, 0)
+		weights, varianceSum := 0.0, 0.0
+		for dy := -2; dy <= 2; dy++ {
+			qy := py + dy*step
+			if qy < 0 || qy >= f.height {
+				continue
+			}
+			for dx := -2; dx <= 2; dx++ {
+				qx := px + dx*step
+				if qx < 0 || qx >= f.width {
+					continue
+				}
+				q := qx + f.width*qy
+				fq := &features[q]
+				if fp.hit != fq.hit {
+					continue
+				}
+				w := atrousKernel[abs(dx)] * atrousKernel[abs(dy)]
+				if fp.hit {
+					w *= math.Pow(math.Max(0, fp.normal.DotProduct(fq.normal)), sigmaNormal)
+					w *= math.Exp(-math.Abs(fp.depth-fq.depth) / (sigmaDepth*fp.depth*float64(step) + 1e-6))
+				}
+				w *= math.Exp(-math.Abs(lp-irradiance[q].Luminance()) / sigmaL)
+				if w == 0 {
+					continue
+				}
+				sum = AddColor(*sum, *MultC(&irradiance[q], w))
+				weights += w
+				varianceSum += w * w * variance[q]
+			}
+		}
+		/* the center pixel weighs its kernel value unless its mean normal averages to zero,
+		   nothing is filtered then */
+		if weights == 0 {
+			filtered[p] = irradiance[p]
+			filteredVariance[p] = variance[p]
+			continue
+		}
+		filtered[p] = *MultC(sum, 1/weights)
+		filteredVariance[p] = varianceSum / (weights * weights)
+	}
+	return filtered, filteredVariance
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	. "geometry"
+	"sort"
+)
+
+const (
+	TreeLightSampling = iota
+	PowerLightSampling
+)
+
+/* largest float64 below 1, keeps remapped random numbers in [0,1) */
+const oneMinusEpsilon float64 = 0x1.fffffffffffffp-1
+
+/* chooses the emitter to sample for a shading point, and gives back the probability of that choice */
+type emitterSampler interface {
+	sample(u float64, p *Point3) (Light, float64)
+	pdfOf(l Light, p *Point3) float64
+}
+
+/* discrete distribution over the lights, proportional to their emitted power,
+   sampled by inverting its CDF */
+type emitterDistribution struct {
+	lights []Light
+	cdf []float64
+	pdf map[Light]float64
+}
+
+func newEmitterDistribution(lights []Light) *emitterDistribution {
+	d := &emitterDistribution{pdf: make(map[Light]float64)}
+	
+	total := 0.0
+	for _, l := range lights {
+		power := l.Power()
+		if power <= 0 {
+			continue
+		}
+		total += power
+		d.lights = append(d.lights, l)
+		d.cdf = append(d.cdf, total)
+	}
+	
+	for i, l := range d.lights {
+		d.cdf[i] /= total
+		d.pdf[l] += l.Power() / total
+	}
+	return d
+}
+
+/* u uniform in [0,1), the shading point doesn't matter */
+func (d *emitterDistribution) sample(u float64, p *Point3) (Light, float64) {
+	if len(d.lights) == 0 {
+		return nil, 0
+	}
+	index := sort.SearchFloat64s(d.cdf, u)
+	if index >= len(d.lights) {
+		index = len(d.lights) - 1
+	}
+	return d.lights[index], d.pdf[d.lights[index]]
+}
+
+func (d *emitterDistribution) pdfOf(l Light, p *Point3) float64 {
+	return d.pdf[l]
+}
+
+func newEmitterSampler(lightSampling int, lights []Light) emitterSampler {
+	if lightSampling == PowerLightSampling {
+		return newEmitterDistribution(lights)
+	}
+	return newLightTree(lights)
+}
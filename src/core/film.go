@@ -0,0 +1,135 @@
+package core
+
+import (
+	. "geometry"
+	"math"
+	"sync"
+)
+
+/* floor added to the pixel mean so that black pixels don't get an infinite relative error */
+const errorFloor float64 = 1e-2
+
+/* running statistics of one pixel :
+   color sum for the estimate, Welford mean and M2 of the sample luminance for the variance */
+type pixelStats struct {
+	sum Color
+	count int
+	mean float64
+	m2 float64
+}
+
+func (p *pixelStats) add(c *Color) {
+	p.sum = *AddColor(p.sum, *c)
+	p.count++
+	l := c.Luminance()
+	delta := l - p.mean
+	p.mean += delta / float64(p.count)
+	p.m2 += delta * (l - p.mean)
+}
+
+func (p *pixelStats) variance() float64 {
+	if p.count < 2 {
+		return 0
+	}
+	return p.m2 / float64(p.count-1)
+}
+
+/* standard error of the pixel estimate relative to its luminance */
+func (p *pixelStats) relativeError() float64 {
+	if p.count < 2 {
+		return math.Inf(1)
+	}
+	return math.Sqrt(p.variance()/float64(p.count)) / (p.mean + errorFloor)
+}
+
+type Film struct {
+	width, height int
+	pixels []pixelStats
+	/* AOV buffers, nil when none is asked for */
+	aovs *aovBuffers
+	/* filtered estimate, nil until Denoise */
+	denoised []Color
+	/* reconstruction filter, weighted sums of the splats and their weights, one lock per row
+	   since samples of neighbouring pixels taken by different workers splat into the same ones */
+	filter Filter
+	splats []Color
+	weights []float64
+	rows []sync.Mutex
+}
+
+/* a film with a box filter of radius 0.5 : every sample only counts for its own pixel */
+func NewFilm(width int, height int) *Film {
+	return &Film{width, height, make([]pixelStats, width*height), nil, nil, NewBoxFilter(0.5), make([]Color, width*height), make([]float64, width*height), make([]sync.Mutex, height)}
+}
+
+func (f *Film) SetFilter(filter Filter) {
+	f.filter = filter
+}
+
+/* gathers the AOV buffers along the beauty, mask is the bits of those to write out */
+func (f *Film) EnableAOVs(mask int) {
+	f.aovs = newAOVBuffers(mask, f.width*f.height)
+}
+
+/* adds a sample taken at film position (fx,fy) in pixel (x,y) : to the statistics of the pixel
+   and, weighted by the filter, to the estimate of every pixel whose center is within its radius */
+func (f *Film) AddSample(x int, y int, fx float64, fy float64, c *Color) {
+	f.pixels[x+(f.width*y)].add(c)
+	
+	r := f.filter.Radius()
+	x0, x1 := int(math.Max(0, math.Ceil(fx-0.5-r))), int(math.Min(float64(f.width-1), math.Floor(fx-0.5+r)))
+	y0, y1 := int(math.Max(0, math.Ceil(fy-0.5-r))), int(math.Min(float64(f.height-1), math.Floor(fy-0.5+r)))
+	for py := y0; py <= y1; py++ {
+		f.rows[py].Lock()
+		for px := x0; px <= x1; px++ {
+			w := f.filter.Evaluate(float64(px)+0.5-fx, float64(py)+0.5-fy)
+			if w == 0 {
+				continue
+			}
+			i := px + f.width*py
+			f.splats[i] = *AddColor(f.splats[i], *MultC(c, w))
+			f.weights[i] += w
+		}
+		f.rows[py].Unlock()
+	}
+}
+
+/* estimate of the pixel : denoised when the film has been, the filtered one otherwise */
+func (f *Film) Color(x int, y int) *Color {
+	if f.denoised != nil {
+		c := f.denoised[x+(f.width*y)]
+		return &c
+	}
+	return f.Filtered(x, y)
+}
+
+/* weighted mean of the splats on the pixel, the plain mean of its own samples
+   when the filter's negative lobes leave no positive weight */
+func (f *Film) Filtered(x int, y int) *Color {
+	i := x + f.width*y
+	if f.weights[i] <= 0 {
+		return f.Mean(x, y)
+	}
+	return MultC(&f.splats[i], 1/f.weights[i])
+}
+
+/* mean of the samples taken in the pixel */
+func (f *Film) Mean(x int, y int) *Color {
+	p := &f.pixels[x+(f.width*y)]
+	if p.count == 0 {
+		return NewColor(0, 0, 0)
+	}
+	return MultC(&p.sum, 1/float64(p.count))
+}
+
+func (f *Film) Samples(x int, y int) int {
+	return f.pixels[x+(f.width*y)].count
+}
+
+func (f *Film) Variance(x int, y int) float64 {
+	return f.pixels[x+(f.width*y)].variance()
+}
+
+func (f *Film) RelativeError(x int, y int) float64 {
+	return f.pixels[x+(f.width*y)].relativeError()
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"math"
+)
+
+/* pixel reconstruction filter : every sample is splatted to the pixels whose center lies within
+   Radius of it, weighted by Evaluate of the offset, and a pixel is the weighted mean of its splats.
+   The filters are separable, Evaluate is the product of the 1D profiles */
+type Filter interface {
+	Radius() float64
+	Evaluate(dx float64, dy float64) float64
+}
+
+/* default radius of each filter, in pixels */
+var filterRadii = map[string]float64{"box": 0.5, "tent": 1, "gaussian": 1.5, "mitchell": 2, "lanczos": 3}
+
+/* filter of that name with that radius, the filter's default radius for 0, nil for an unknown name */
+func FilterByName(name string, radius float64) Filter {
+	if _, ok := filterRadii[name]; !ok {
+		return nil
+	}
+	if radius <= 0 {
+		radius = filterRadii[name]
+	}
+	switch name {
+	case "box":
+		return NewBoxFilter(radius)
+	case "tent":
+		return NewTentFilter(radius)
+	case "gaussian":
+		return NewGaussianFilter(radius, radius/3)
+	case "mitchell":
+		return NewMitchellFilter(radius, 1.0/3, 1.0/3)
+	default:
+		return NewLanczosFilter(radius)
+	}
+}
+
+/* constant weight : with radius 0.5 every sample only counts for the pixel it was taken in */
+type BoxFilter struct {
+	radius float64
+}
+
+func NewBoxFilter(radius float64) *BoxFilter {
+	return &BoxFilter{radius}
+}
+
+func (f *BoxFilter) Radius() float64 {
+	return f.radius
+}
+
+func (f *BoxFilter) Evaluate(dx float64, dy float64) float64 {
+	if math.Abs(dx) > f.radius || math.Abs(dy) > f.radius {
+		return 0
+	}
+	return 1
+}
+
+/* linear fall-off to zero at the radius */
+type TentFilter struct {
+	radius float64
+}
+
+func NewTentFilter(radius float64) *TentFilter {
+	return &TentFilter{radius}
+}
+
+func (f *TentFilter) Radius() float64 {
+	return f.radius
+}
+
+func (f *TentFilter) Evaluate(dx float64, dy float64) float64 {
+	return math.Max(0, f.radius-math.Abs(dx)) * math.Max(0, f.radius-math.Abs(dy))
+}
+
+/* Gaussian of standard deviation sigma, shifted down to reach zero at the radius */
+type GaussianFilter struct {
+	radius, sigma float64
+	edge float64
+}
+
+func NewGaussianFilter(radius float64, sigma float64) *GaussianFilter {
+	f := &GaussianFilter{radius: radius, sigma: sigma}
+	f.edge = f.gaussian(radius)
+	return f
+}
+
+func (f *GaussianFilter) gaussian(x float64) float64 {
+	return math.Exp(-x * x / (2 * f.sigma * f.sigma))
+}
+
+func (f *GaussianFilter) Radius() float64 {
+	return f.radius
+}
+
+func (f *GaussianFilter) Evaluate(dx float64, dy float64) float64 {
+	return math.Max(0, f.gaussian(dx)-f.edge) * math.Max(0, f.gaussian(dy)-f.edge)
+}
+
+/* Mitchell-Netravali cubic of parameters b and c, stretched over the radius.
+   b = c = 1/3 is their recommended compromise between blurring and ringing */
+type MitchellFilter struct {
+	radius, b, c float64
+}
+
+func NewMitchellFilter(radius float64, b float64, c float64) *MitchellFilter {
+	return &MitchellFilter{radius, b, c}
+}
+
+func (f *MitchellFilter) Radius() float64 {
+	return f.radius
+}
+
+/* cubic over [-2, 2] */
+func (f *MitchellFilter) mitchell(x float64) float64 {
+	x = math.Abs(2 * x / f.radius)
+	b, c := f.b, f.c
+	switch {
+	case x > 2:
+		return 0
+	case x > 1:
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	default:
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	}
+}
+
+func (f *MitchellFilter) Evaluate(dx float64, dy float64) float64 {
+	return f.mitchell(dx) * f.mitchell(dy)
+}
+
+/* sinc windowed by the central lobe of a sinc as wide as the radius, which is the number of lobes */
+type LanczosFilter struct {
+	radius float64
+}
+
+func NewLanczosFilter(radius float64) *LanczosFilter {
+	return &LanczosFilter{radius}
+}
+
+func (f *LanczosFilter) Radius() float64 {
+	return f.radius
+}
+
+func (f *LanczosFilter) lanczos(x float64) float64 {
+	x = math.Abs(x)
+	if x > f.radius {
+		return 0
+	}
+	return sinc(x) * sinc(x/f.radius)
+}
+
+func (f *LanczosFilter) Evaluate(dx float64, dy float64) float64 {
+	return f.lanczos(dx) * f.lanczos(dy)
+}
+
+func sinc(x float64) float64 {
+	if x < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	. "geometry"
+	"accelerators"
+)
+
+/* what a parsed scene is made of */
+type SceneInfo struct {
+	Triangles int
+	/* emitting triangles, and the other lights */
+	Emitters, Lights int
+	Tree accelerators.Stats
+	/* animated triangles, out of Tree, and their tree as it is before the first frame poses them */
+	Animated int
+	AnimatedTree accelerators.Stats
+	/* sum of the light powers, luminance of the flux in renderer units */
+	Power float64
+	Views int
+}
+
+func (scene *Scene) Info() *SceneInfo {
+	info := &SceneInfo{Tree: accelerators.TreeStats(scene.tree), Views: len(scene.views)}
+	for _, t := range scene.prims {
+		if t != nil {
+			info.Triangles++
+		}
+	}
+	for _, l := range scene.sources {
+		if _, ok := l.(*AreaLight); ok {
+			info.Emitters++
+		} else {
+			info.Lights++
+		}
+		info.Power += l.Power()
+	}
+	if scene.animation != nil {
+		var tree accelerators.Tree = &accelerators.EmptyTree{}
+		for _, o := range scene.animation.objects {
+			for _, t := range o.triangles {
+				tree = accelerators.Insert(tree, t)
+				info.Animated++
+			}
+		}
+		info.AnimatedTree = accelerators.TreeStats(tree)
+	}
+	return info
+}
+
+/* bounds of the triangles of the scene */
+func (scene *Scene) Enveloppe() *BoundingBox {
+	return scene.enveloppe
+}
+
+/* the camera line as main, and the named views */
+func (scene *Scene) Cameras() map[string]*Camera {
+	cameras := map[string]*Camera{"main": scene.camera}
+	for name, c := range scene.views {
+		cameras[name] = c
+	}
+	return cameras
+}
+
+func (camera *Camera) Position() Point3 {
+	return camera.position
+}
+
+func (camera *Camera) Direction() Vector3 {
+	return camera.direction
+}
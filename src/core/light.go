@@ -0,0 +1,305 @@
+package core
+
+import (
+	. "geometry"
+	"math"
+	mrand "math/rand"
+)
+
+/* what a light gives to a shading point : the direction toward the light, how far the light is,
+   the radiance arriving along that direction and the solid angle density of the choice
+   (1 for delta lights). emitter is the triangle sampled, for area lights only */
+type LightSample struct {
+	direction Vector3
+	distance float64
+	radiance *Color
+	pdf float64
+	emitter *Triangle
+}
+
+type Light interface {
+	/* time is the instant of the shutter interval of the path */
+	SampleLi(p *Point3, time float64) *LightSample
+	/* emitted flux, used to choose between lights */
+	Power() float64
+	/* lights without area can't be found by BSDF sampling */
+	IsDelta() bool
+	preprocess(enveloppe *BoundingBox)
+	/* light tree leaf, nil for lights at infinity */
+	leaf() *lightNode
+	/* spectrum of the light, nil for an RGB light */
+	emission() *SpectralEmission
+}
+
+/* a light that rays leaving the scene can reach */
+type infiniteLight interface {
+	Le(dir *Vector3) *Color
+	pdfLi(dir *Vector3) float64
+}
+
+type AreaLight struct {
+	triangle *Triangle
+}
+
+func NewAreaLight(t *Triangle) *AreaLight {
+	return &AreaLight{t}
+}
+
+func (l *AreaLight) SampleLi(p *Point3, time float64) *LightSample {
+	triangle := l.triangle.At(time)
+	position := SamplePoint(triangle)
+	ray := *NewVectorFromPoints(*p, *position)
+	distance := math.Sqrt(ray.DotProduct(ray))
+	direction := MultV(ray, 1/distance)
+	back := NegativeV(direction)
+	sp := NewSurfacePoint(position, triangle)
+	return &LightSample{direction, distance, sp.SurfacePointEmission(p, &back, false), sp.SurfacePointSolidAnglePdf(p), l.triangle}
+}
+
+func (l *AreaLight) Power() float64 {
+	power := math.Pi * l.triangle.Area() * l.triangle.Emit().Luminance()
+	if l.triangle.EmitSides() == EmitBoth {
+		return 2 * power
+	}
+	return power
+}
+
+func (l *AreaLight) emission() *SpectralEmission {
+	return l.triangle.SpectralEmission()
+}
+
+func (l *AreaLight) IsDelta() bool {
+	return false
+}
+
+func (l *AreaLight) preprocess(enveloppe *BoundingBox) {
+}
+
+/* a moving emitter is bounded over the whole shutter interval : its vertices move linearly, the
+   boxes at both ends hold every instant. Its normal only stays put when it is translated */
+func (l *AreaLight) leaf() *lightNode {
+	start, end := l.triangle.At(0), l.triangle.At(1)
+	startBox, endBox := start.Box(), end.Box()
+	bbox := *ExpandBBox(&startBox, &endBox).(*BoundingBox)
+	cone := directionCone{start.Normal(), 0}
+	switch l.triangle.EmitSides() {
+	case EmitBack:
+		cone.axis = NegativeV(cone.axis)
+	case EmitBoth:
+		cone.theta = math.Pi
+	}
+	if !translated(start, end) {
+		cone.theta = math.Pi
+	}
+	return &lightNode{bbox: bbox, cone: cone, thetaE: math.Pi / 2}
+}
+
+/* b is a moved without turning nor deforming, up to rounding errors */
+func translated(a *Triangle, b *Triangle) bool {
+	va, vb := a.Vertices(), b.Vertices()
+	for i := 1; i < 3; i++ {
+		ea, eb := NewVectorFromPoints(va[0], va[i]), NewVectorFromPoints(vb[0], vb[i])
+		d := ea.AddV(NegativeV(*eb))
+		if d.DotProduct(d) > 1e-12*ea.DotProduct(*ea) {
+			return false
+		}
+	}
+	return true
+}
+
+/* isotropic point light, intensity in W/sr */
+type PointLight struct {
+	position Point3
+	intensity Color
+	spectral *SpectralEmission
+}
+
+func NewPointLight(position *Point3, intensity *Color) *PointLight {
+	return &PointLight{*position, *intensity, nil}
+}
+
+/* intensity given by a spectrum, in candelas */
+func (l *PointLight) SetSpectralEmission(e *SpectralEmission) {
+	l.spectral = e
+	l.intensity = *e.RGB()
+}
+
+func (l *PointLight) emission() *SpectralEmission {
+	return l.spectral
+}
+
+func (l *PointLight) SampleLi(p *Point3, time float64) *LightSample {
+	return sampleDeltaPosition(p, &l.position, &l.intensity)
+}
+
+func (l *PointLight) Power() float64 {
+	return 4 * math.Pi * l.intensity.Luminance()
+}
+
+func (l *PointLight) IsDelta() bool {
+	return true
+}
+
+func (l *PointLight) preprocess(enveloppe *BoundingBox) {
+}
+
+func (l *PointLight) leaf() *lightNode {
+	return &lightNode{bbox: *pointBox(&l.position), cone: entireSphere, thetaE: math.Pi / 2}
+}
+
+/* point light restricted to a cone : full intensity up to the inner angle,
+   smoothstep falloff down to zero at the outer angle */
+type SpotLight struct {
+	position Point3
+	direction Vector3
+	intensity Color
+	cosInner, cosOuter float64
+	spectral *SpectralEmission
+}
+
+/* angles in degrees */
+func NewSpotLight(position *Point3, direction *Vector3, intensity *Color, inner float64, outer float64) *SpotLight {
+	outer = math.Max(outer, 1e-3)
+	inner = math.Min(inner, outer)
+	return &SpotLight{*position, UnitizeV(*direction), *intensity, math.Cos(inner * math.Pi / 180), math.Cos(outer * math.Pi / 180), nil}
+}
+
+/* intensity on the axis given by a spectrum, in candelas */
+func (l *SpotLight) SetSpectralEmission(e *SpectralEmission) {
+	l.spectral = e
+	l.intensity = *e.RGB()
+}
+
+func (l *SpotLight) emission() *SpectralEmission {
+	return l.spectral
+}
+
+func (l *SpotLight) falloff(cosTheta float64) float64 {
+	if cosTheta >= l.cosInner {
+		return 1
+	}
+	if cosTheta <= l.cosOuter {
+		return 0
+	}
+	t := (cosTheta - l.cosOuter) / (l.cosInner - l.cosOuter)
+	return t * t * (3 - 2*t)
+}
+
+func (l *SpotLight) SampleLi(p *Point3, time float64) *LightSample {
+	ls := sampleDeltaPosition(p, &l.position, &l.intensity)
+	ls.radiance = MultC(ls.radiance, l.falloff(NegativeV(ls.direction).DotProduct(l.direction)))
+	return ls
+}
+
+func (l *SpotLight) Power() float64 {
+	return 2 * math.Pi * (1 - 0.5*(l.cosInner+l.cosOuter)) * l.intensity.Luminance()
+}
+
+func (l *SpotLight) IsDelta() bool {
+	return true
+}
+
+func (l *SpotLight) preprocess(enveloppe *BoundingBox) {
+}
+
+func (l *SpotLight) leaf() *lightNode {
+	return &lightNode{bbox: *pointBox(&l.position), cone: directionCone{l.direction, math.Acos(l.cosOuter)}, thetaE: 0}
+}
+
+/* sun : parallel light of the given irradiance, spread over a disc of angular radius
+   (in degrees) around its direction. A zero radius gives a delta light */
+type DirectionalLight struct {
+	direction Vector3
+	irradiance Color
+	cosMax float64
+	sceneRadius float64
+	spectral *SpectralEmission
+}
+
+func NewDirectionalLight(direction *Vector3, irradiance *Color, angularRadius float64) *DirectionalLight {
+	return &DirectionalLight{UnitizeV(*direction), *irradiance, math.Cos(angularRadius * math.Pi / 180), 0, nil}
+}
+
+/* irradiance given by a spectrum, in lux */
+func (l *DirectionalLight) SetSpectralEmission(e *SpectralEmission) {
+	l.spectral = e
+	l.irradiance = *e.RGB()
+}
+
+func (l *DirectionalLight) emission() *SpectralEmission {
+	return l.spectral
+}
+
+func (l *DirectionalLight) solidAngle() float64 {
+	return 2 * math.Pi * (1 - l.cosMax)
+}
+
+func (l *DirectionalLight) SampleLi(p *Point3, time float64) *LightSample {
+	toSun := NegativeV(l.direction)
+	if l.IsDelta() {
+		return &LightSample{toSun, math.Inf(1), NewColor(l.irradiance.RGB()), 1, nil}
+	}
+	/* uniform direction in the cone around toSun */
+	cosTheta := 1 - mrand.Float64()*(1-l.cosMax)
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * mrand.Float64()
+	t, b := orthonormalBasis(toSun)
+	dir := MultV(t, math.Cos(phi)*sinTheta).AddV(MultV(b, math.Sin(phi)*sinTheta)).AddV(MultV(toSun, cosTheta))
+	return &LightSample{dir, math.Inf(1), MultC(&l.irradiance, 1/l.solidAngle()), 1 / l.solidAngle(), nil}
+}
+
+func (l *DirectionalLight) Le(dir *Vector3) *Color {
+	if l.IsDelta() || NegativeV(l.direction).DotProduct(*dir) < l.cosMax {
+		return NewColor(0, 0, 0)
+	}
+	return MultC(&l.irradiance, 1/l.solidAngle())
+}
+
+func (l *DirectionalLight) pdfLi(dir *Vector3) float64 {
+	if l.IsDelta() || NegativeV(l.direction).DotProduct(*dir) < l.cosMax {
+		return 0
+	}
+	return 1 / l.solidAngle()
+}
+
+func (l *DirectionalLight) Power() float64 {
+	return math.Pi * l.sceneRadius * l.sceneRadius * l.irradiance.Luminance()
+}
+
+func (l *DirectionalLight) IsDelta() bool {
+	return l.cosMax >= 1
+}
+
+func (l *DirectionalLight) preprocess(enveloppe *BoundingBox) {
+	n := &lightNode{bbox: *enveloppe}
+	n.bound()
+	l.sceneRadius = n.radius
+}
+
+func (l *DirectionalLight) leaf() *lightNode {
+	return nil
+}
+
+/* delta position light of the given intensity, seen from p */
+func sampleDeltaPosition(p *Point3, position *Point3, intensity *Color) *LightSample {
+	ray := *NewVectorFromPoints(*p, *position)
+	distance2 := math.Max(ray.DotProduct(ray), 1e-6)
+	distance := math.Sqrt(distance2)
+	return &LightSample{MultV(ray, 1/distance), distance, MultC(intensity, 1/distance2), 1, nil}
+}
+
+func pointBox(p *Point3) *BoundingBox {
+	return NewBBox(*NewInterval(p.X(), p.X()), *NewInterval(p.Y(), p.Y()), *NewInterval(p.Z(), p.Z()))
+}
+
+/* two unit vectors completing n into an orthonormal frame */
+func orthonormalBasis(n Vector3) (Vector3, Vector3) {
+	var a Vector3
+	if math.Abs(n.X()) > 0.9 {
+		a = *NewVector(0, 1, 0)
+	} else {
+		a = *NewVector(1, 0, 0)
+	}
+	t := UnitizeV(n.CrossProduct(a))
+	return t, n.CrossProduct(t)
+}
@@ -0,0 +1,250 @@
+package core
+
+import (
+	. "geometry"
+	"math"
+	"sort"
+)
+
+/* bounds of the emitter orientations of a node : normals within theta of axis */
+type directionCone struct {
+	axis Vector3
+	theta float64
+}
+
+var entireSphere = directionCone{*NewVector(0, 0, 1), math.Pi}
+
+func angleBetween(v0 Vector3, v1 Vector3) float64 {
+	return math.Acos(math.Max(-1, math.Min(1, v0.DotProduct(v1))))
+}
+
+/* rotation of v by angle around the unit axis k (Rodrigues' formula) */
+func rotate(v Vector3, k Vector3, angle float64) Vector3 {
+	r := MultV(v, math.Cos(angle)).AddV(MultV(k.CrossProduct(v), math.Sin(angle)))
+	return r.AddV(MultV(k, k.DotProduct(v)*(1-math.Cos(angle))))
+}
+
+/* smallest cone containing both cones */
+func unionCone(a directionCone, b directionCone) directionCone {
+	thetaD := angleBetween(a.axis, b.axis)
+	if math.Min(thetaD+b.theta, math.Pi) <= a.theta {
+		return a
+	}
+	if math.Min(thetaD+a.theta, math.Pi) <= b.theta {
+		return b
+	}
+	thetaO := (a.theta + thetaD + b.theta) / 2
+	if thetaO >= math.Pi {
+		return entireSphere
+	}
+	k := a.axis.CrossProduct(b.axis)
+	if IsNillVector(k) {
+		return entireSphere
+	}
+	return directionCone{UnitizeV(rotate(a.axis, UnitizeV(k), thetaO-a.theta)), thetaO}
+}
+
+type lightNode struct {
+	bbox BoundingBox
+	center Point3
+	radius float64
+	cone directionCone
+	/* each emitter lights directions up to thetaE away from its normal */
+	thetaE float64
+	power float64
+	left, right, parent *lightNode
+	light Light
+}
+
+func newLightLeaf(l Light) *lightNode {
+	n := l.leaf()
+	n.power = l.Power()
+	n.light = l
+	n.bound()
+	return n
+}
+
+func newLightInner(left *lightNode, right *lightNode) *lightNode {
+	bbox := ExpandBBox(&left.bbox, &right.bbox).(*BoundingBox)
+	n := &lightNode{bbox: *bbox, cone: unionCone(left.cone, right.cone), thetaE: math.Max(left.thetaE, right.thetaE), power: left.power + right.power, left: left, right: right}
+	n.bound()
+	left.parent = n
+	right.parent = n
+	return n
+}
+
+/* bounding sphere of the node box */
+func (n *lightNode) bound() {
+	var c [3]float64
+	var r2 float64
+	for axis := 0; axis < 3; axis++ {
+		c[axis] = (n.bbox.GetLowerFromAxis(axis) + n.bbox.GetUpperFromAxis(axis)) * 0.5
+		half := (n.bbox.GetUpperFromAxis(axis) - n.bbox.GetLowerFromAxis(axis)) * 0.5
+		r2 += half * half
+	}
+	n.center = *NewPoint(c[0], c[1], c[2])
+	n.radius = math.Sqrt(r2)
+}
+
+/* conservative estimate of the light the node sends to p : power over squared distance,
+   times the best cosine any of its emitters could have toward p */
+func (n *lightNode) importance(p *Point3) float64 {
+	wi := *NewVectorFromPoints(n.center, *p)
+	d2 := wi.DotProduct(wi)
+	if d2 <= n.radius*n.radius {
+		/* p inside the bounding sphere, every direction is possible */
+		return n.power / math.Max(d2, n.radius*n.radius*0.25)
+	}
+	thetaW := angleBetween(n.cone.axis, UnitizeV(wi))
+	thetaB := math.Asin(n.radius / math.Sqrt(d2))
+	thetaPrime := math.Max(0, thetaW-n.cone.theta-thetaB)
+	if thetaPrime > n.thetaE {
+		return 0
+	}
+	return n.power * math.Cos(thetaPrime) / d2
+}
+
+func (n *lightNode) sibling() *lightNode {
+	if n.parent.left == n {
+		return n.parent.right
+	}
+	return n.parent.left
+}
+
+/* light BVH : emitters are grouped by position, and every traversal step chooses
+   a child proportionally to its importance for the shading point.
+   Lights at infinity have no bounds, they are chosen uniformly beside the tree */
+type lightTree struct {
+	root *lightNode
+	leaves map[Light]*lightNode
+	infinite []Light
+}
+
+func newLightTree(lights []Light) *lightTree {
+	tree := &lightTree{leaves: make(map[Light]*lightNode)}
+	var nodes []*lightNode
+	for _, l := range lights {
+		if l.Power() <= 0 {
+			continue
+		}
+		if l.leaf() == nil {
+			tree.infinite = append(tree.infinite, l)
+			continue
+		}
+		leaf := newLightLeaf(l)
+		tree.leaves[l] = leaf
+		nodes = append(nodes, leaf)
+	}
+	if len(nodes) > 0 {
+		tree.root = buildLightNodes(nodes)
+	}
+	return tree
+}
+
+/* median split of the leaf centers along their widest axis */
+func buildLightNodes(nodes []*lightNode) *lightNode {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+
+	axis := 0
+	widest := -1.0
+	for a := 0; a < 3; a++ {
+		lower, upper := math.Inf(1), math.Inf(-1)
+		for _, n := range nodes {
+			c := centerOnAxis(n, a)
+			lower = math.Min(lower, c)
+			upper = math.Max(upper, c)
+		}
+		if upper-lower > widest {
+			widest = upper - lower
+			axis = a
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return centerOnAxis(nodes[i], axis) < centerOnAxis(nodes[j], axis) })
+	middle := len(nodes) / 2
+	return newLightInner(buildLightNodes(nodes[:middle]), buildLightNodes(nodes[middle:]))
+}
+
+func centerOnAxis(n *lightNode, axis int) float64 {
+	return (n.bbox.GetLowerFromAxis(axis) + n.bbox.GetUpperFromAxis(axis)) * 0.5
+}
+
+/* no light in the tree nor at infinity : nothing to sample, the sky alone lights the scene */
+func (tree *lightTree) empty() bool {
+	return tree.root == nil && len(tree.infinite) == 0
+}
+
+/* probability of choosing among the lights at infinity rather than in the tree */
+func (tree *lightTree) infiniteProbability() float64 {
+	if tree.root == nil {
+		return 1
+	}
+	return float64(len(tree.infinite)) / float64(len(tree.infinite)+1)
+}
+
+func (tree *lightTree) sample(u float64, p *Point3) (Light, float64) {
+	if tree.empty() {
+		return nil, 0
+	}
+	pInfinite := tree.infiniteProbability()
+	if u < pInfinite {
+		index := int(math.Min(u/pInfinite*float64(len(tree.infinite)), float64(len(tree.infinite)-1)))
+		return tree.infinite[index], pInfinite / float64(len(tree.infinite))
+	}
+	u = math.Min((u-pInfinite)/(1-pInfinite), oneMinusEpsilon)
+	
+	if tree.root == nil || tree.root.importance(p) <= 0 {
+		return nil, 0
+	}
+	node := tree.root
+	pdf := 1 - pInfinite
+	for node.light == nil {
+		il := node.left.importance(p)
+		ir := node.right.importance(p)
+		if il+ir <= 0 {
+			return nil, 0
+		}
+		pl := il / (il + ir)
+		if u < pl {
+			node = node.left
+			u = math.Min(u/pl, oneMinusEpsilon)
+			pdf *= pl
+		} else {
+			node = node.right
+			u = math.Min((u-pl)/(1-pl), oneMinusEpsilon)
+			pdf *= 1 - pl
+		}
+	}
+	return node.light, pdf
+}
+
+func (tree *lightTree) pdfOf(l Light, p *Point3) float64 {
+	if tree.empty() {
+		return 0
+	}
+	pInfinite := tree.infiniteProbability()
+	leaf, ok := tree.leaves[l]
+	if !ok {
+		for _, inf := range tree.infinite {
+			if inf == l {
+				return pInfinite / float64(len(tree.infinite))
+			}
+		}
+		return 0
+	}
+	if tree.root.importance(p) <= 0 {
+		return 0
+	}
+	pdf := 1 - pInfinite
+	for node := leaf; node.parent != nil; node = node.parent {
+		in := node.importance(p)
+		is := node.sibling().importance(p)
+		if in+is <= 0 {
+			return 0
+		}
+		pdf *= in / (in + is)
+	}
+	return pdf
+}
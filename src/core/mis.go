@@ -0,0 +1,31 @@
+package core
+
+const (
+	PowerHeuristic = iota
+	BalanceHeuristic
+)
+
+/* multiple importance sampling weight of a sample drawn with density pdfA,
+   when the same path could have been drawn by another strategy with density pdfB */
+func powerHeuristic(pdfA float64, pdfB float64) float64 {
+	a2 := pdfA * pdfA
+	b2 := pdfB * pdfB
+	if a2+b2 == 0 {
+		return 0
+	}
+	return a2 / (a2 + b2)
+}
+
+func balanceHeuristic(pdfA float64, pdfB float64) float64 {
+	if pdfA+pdfB == 0 {
+		return 0
+	}
+	return pdfA / (pdfA + pdfB)
+}
+
+func (scene *Scene) misWeight(pdfA float64, pdfB float64) float64 {
+	if scene.opts.heuristic == BalanceHeuristic {
+		return balanceHeuristic(pdfA, pdfB)
+	}
+	return powerHeuristic(pdfA, pdfB)
+}
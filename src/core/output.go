@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"exr"
+	. "geometry"
+	"hash/crc32"
+	"image"
+	png "image/png"
+	"os"
+)
+
+/* PNG image tagged with its color space : a cICP chunk (primaries and transfer function),
+   an sRGB chunk for sRGB output, and the names of the display and working spaces as text */
+func writePNG(path string, img image.Image, display *ColorSpace, working *ColorSpace) error {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return err
+	}
+	data := encoded.Bytes()
+	
+	var chunks bytes.Buffer
+	primaries, transfer := display.CICP()
+	/* matrix coefficients 0 (RGB), full range */
+	writeChunk(&chunks, "cICP", []byte{primaries, transfer, 0, 1})
+	if display == SRGB {
+		/* perceptual rendering intent */
+		writeChunk(&chunks, "sRGB", []byte{0})
+	}
+	writeChunk(&chunks, "tEXt", append([]byte("Color space\x00"), display.Name()...))
+	writeChunk(&chunks, "tEXt", append([]byte("Working space\x00"), working.Name()...))
+	
+	/* signature, then IHDR (length, type, 13 bytes of data, crc) : the chunks go right after */
+	ihdrEnd := 8 + 8 + 13 + 4
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, part := range [][]byte{data[:ihdrEnd], chunks.Bytes(), data[ihdrEnd:]} {
+		if _, err := f.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeChunk(b *bytes.Buffer, kind string, data []byte) {
+	binary.Write(b, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	b.WriteString(kind)
+	b.Write(data)
+	binary.Write(b, binary.BigEndian, crc.Sum32())
+}
+
+/* OpenEXR output of the film : the beauty in R G B, every AOV in a layer of its name,
+   linear values of the working space. Depth and identifiers are always stored as floats */
+func (scene *Scene) writeEXR(path string, film *Film) error {
+	img := exr.NewImage(film.width, film.height)
+	window := scene.window()
+	img.X, img.Y = window.x0, window.y0
+	img.DisplayWidth, img.DisplayHeight = scene.opts.imWidth, scene.opts.imHeight
+	img.Compression = scene.opts.exrCompression
+	img.TileSize = scene.opts.exrTileSize
+	img.Chromaticities = scene.opts.working.Chromaticities()
+	img.Attributes["colorSpace"] = scene.opts.working.Name()
+	pixelType := scene.opts.exrPixelType
+	
+	addColor := func(layer string, names [3]string, at func(x, y int) *Color) {
+		var channels [3][]float32
+		for i := range channels {
+			channels[i] = make([]float32, film.width*film.height)
+		}
+		for y := 0; y < film.height; y++ {
+			for x := 0; x < film.width; x++ {
+				r, g, b := at(x, y).RGB()
+				i := x + film.width*y
+				channels[0][i], channels[1][i], channels[2][i] = float32(r), float32(g), float32(b)
+			}
+		}
+		for i := range channels {
+			img.AddChannel(layer, names[i], pixelType, channels[i])
+		}
+	}
+	rgb := [3]string{"R", "G", "B"}
+	addColor("", rgb, film.Color)
+	if film.denoised != nil {
+		addColor("noisy", rgb, film.Filtered)
+	}
+	
+	if b := film.aovs; b != nil {
+		if b.mask&AOVAlbedo != 0 {
+			addColor("albedo", rgb, film.Albedo)
+		}
+		if b.mask&AOVNormal != 0 {
+			addColor("normal", [3]string{"X", "Y", "Z"}, film.Normal)
+		}
+		for _, l := range []struct {
+			bit int
+			name string
+			buffer []Color
+		}{{AOVEmission, "emission", b.emission}, {AOVDirect, "direct", b.direct}, {AOVIndirect, "indirect", b.indirect}} {
+			if b.mask&l.bit != 0 {
+				buffer := l.buffer
+				addColor(l.name, rgb, func(x, y int) *Color { return film.lighting(buffer, x, y) })
+			}
+		}
+		if b.mask&AOVDepth != 0 {
+			depth := make([]float32, film.width*film.height)
+			for i := range depth {
+				depth[i] = float32(film.Depth(i%film.width, i/film.width))
+			}
+			img.AddChannel("depth", "Z", exr.Float, depth)
+		}
+		for _, l := range []struct {
+			bit int
+			name string
+			ids []int
+		}{{AOVTriangle, "triangle", b.triangle}, {AOVObject, "object", b.object}} {
+			if b.mask&l.bit == 0 {
+				continue
+			}
+			ids := make([]float32, len(l.ids))
+			for i, id := range l.ids {
+				ids[i] = float32(id)
+			}
+			img.AddChannel(l.name, "id", exr.Float, ids)
+		}
+		if b.mask&AOVObject != 0 {
+			names := ""
+			for i, n := range scene.objectNames {
+				if i > 0 {
+					names += " "
+				}
+				names += n
+			}
+			img.Attributes["objectNames"] = names
+		}
+	}
+	
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return exr.Write(f, img)
+}
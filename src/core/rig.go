@@ -0,0 +1,82 @@
+package core
+
+import (
+	. "geometry"
+	"fmt"
+	"math"
+	"sort"
+)
+
+/* views of the scene other than the one of the camera line, rendered from the same scene,
+   tree and lights. Animated cameras only move the default view */
+func (scene *Scene) AddView(name string, camera *Camera) {
+	if scene.views == nil {
+		scene.views = make(map[string]*Camera)
+	}
+	scene.views[name] = camera
+}
+
+/* names of the views, in alphabetical order */
+func (scene *Scene) Views() []string {
+	var names []string
+	for name := range scene.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/* renders from the named view, "" for the camera line */
+func (scene *Scene) SetView(name string) error {
+	if name == "" {
+		scene.view = nil
+		return nil
+	}
+	camera, ok := scene.views[name]
+	if !ok {
+		return fmt.Errorf("no view named %s", name)
+	}
+	scene.view = camera
+	return nil
+}
+
+/* camera of the view rendered */
+func (scene *Scene) currentCamera() *Camera {
+	if scene.view != nil {
+		return scene.view
+	}
+	return scene.camera
+}
+
+/* left and right eyes interocular apart across the camera, turned in toward the point
+   convergence away in front of it, parallel for a convergence of 0 */
+func NewStereoPair(camera *Camera, interocular float64, convergence float64) (*Camera, *Camera) {
+	eye := func(side float64) *Camera {
+		offset := MultV(camera.right, side*interocular/2)
+		position := *NewPointFromVector(&camera.position, &offset)
+		direction := camera.direction
+		if convergence > 0 {
+			ahead := MultV(camera.direction, convergence)
+			direction = *NewVectorFromPoints(position, *NewPointFromVector(&camera.position, &ahead))
+		}
+		return NewCamera(position, direction, camera.fov())
+	}
+	return eye(-1), eye(1)
+}
+
+/* views cameras turned around the vertical axis through center, evenly over a full turn,
+   the first one being the camera itself */
+func NewTurntable(camera *Camera, center Point3, views int) []*Camera {
+	cameras := make([]*Camera, views)
+	for i := range cameras {
+		angle := 360 * float64(i) / float64(views)
+		turn := NewTransform(Vector3{}, *NewVector(0, angle, 0), 1, center)
+		cameras[i] = NewCamera(turn.Point(camera.position), turn.Vector(camera.direction), camera.fov())
+	}
+	return cameras
+}
+
+/* field of view in degrees, as given to NewCamera */
+func (camera *Camera) fov() float64 {
+	return camera.viewAngle * 180 / math.Pi
+}
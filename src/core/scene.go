@@ -7,8 +7,6 @@ import (
 	mrand "math/rand"
 	"image"
 	c "image/color"
-	"os"
-	png "image/png"
 //	"fmt"
 )
 
@@ -23,21 +21,161 @@ type Scene struct {
 	lights []*Triangle
 	tree accelerators.Tree
 	enveloppe *BoundingBox
+	medium *Medium
+	/* linear Rec.709 output of the spectral renderer into the working space */
+	spectralOutput *ColorTransform
+	sources []Light
+	/* identifiers of the triangle and object buffers */
+	triangleIndex map[*Triangle]int
+	objectIndex map[string]int
+	objectNames []string
+	areaLights map[*Triangle]Light
+	emitters emitterSampler
+	/* keyframes, nil for a still. The animated triangles are in a tree of their own, rebuilt
+	   every frame, and the enveloppe grows from the static one to hold them */
+	animation *Animation
+	animatedTree accelerators.Tree
+	staticEnveloppe *BoundingBox
+	frame float64
+	/* named cameras, and the one rendered from, nil for the camera line */
+	views map[string]*Camera
+	view *Camera
 }
 
+/* every emitting triangle becomes an area light, other lights come through AddLight */
 func NewScene(sceneOpts *SceneOpts, camera *Camera, world *World, prims []*Triangle, lights []*Triangle, tree accelerators.Tree, enveloppe *BoundingBox) *Scene {
-	return &Scene{sceneOpts, camera, world, prims, lights, tree, enveloppe}
+	scene := &Scene{sceneOpts, camera, world, prims, lights, tree, enveloppe, nil, nil, nil, nil, nil, nil, make(map[*Triangle]Light), nil, nil, nil, nil, 0, nil, nil}
+	for _, t := range lights {
+		if t != nil {
+			l := NewAreaLight(t)
+			scene.areaLights[t] = l
+			scene.AddLight(l)
+		}
+	}
+	return scene
+}
+
+func (scene *Scene) Primitives() []*Triangle {
+	return scene.prims
+}
+
+/* medium filling the scene outside of the closed meshes, nil for vacuum */
+func (scene *Scene) SetMedium(m *Medium) {
+	scene.medium = m
+}
+
+func (scene *Scene) AddLight(l Light) {
+	l.preprocess(scene.enveloppe)
+	scene.sources = append(scene.sources, l)
 }
 
 type SceneOpts struct {
 	iterations, imWidth, imHeight int
+	adaptive bool
+	threshold float64
+	budget, tileSize int
+	heuristic int
+	lightSampling int
+	spectral bool
+	working, display *ColorSpace
+	whiteBalance float64
+	aovs int
+	exr bool
+	exrPixelType, exrCompression, exrTileSize int
+	denoise bool
+	filter Filter
+	/* region rendered, nil for the whole image, and the image it is pasted into, nil to write it alone */
+	crop *CropWindow
+	composite image.Image
+	/* path of the image without its extension, the AOVs append their names to it */
+	output string
+	/* shutter interval around the frame, in frames */
+	shutterOpen, shutterClose float64
 }
 
 func NewOpts(it int64, width int64, height int64) *SceneOpts {
-	opts := &SceneOpts{int(it), int(width), int(height)}
+	opts := &SceneOpts{iterations: int(it), imWidth: int(width), imHeight: int(height), tileSize: 1, working: LinearRec709, display: SRGB, output: "result"}
 	return opts
 }
 
+/* colors of the scene are linear values of the working space, the image is encoded in the
+   display space. whiteBalance is the temperature in kelvins of the light that should look
+   neutral, 0 for the white of the working space */
+func (opts *SceneOpts) SetColorManagement(working *ColorSpace, display *ColorSpace, whiteBalance float64) {
+	opts.working = working
+	opts.display = display
+	opts.whiteBalance = whiteBalance
+}
+
+/* switches to adaptive sampling : tiles keep being sampled while their relative error is above
+   threshold, until the total sample budget is spent (a budget of 0 means iterations per pixel) */
+func (opts *SceneOpts) SetAdaptive(threshold float64, budget int64, tileSize int64) {
+	opts.adaptive = true
+	opts.threshold = threshold
+	opts.budget = int(budget)
+	opts.tileSize = int(math.Max(1, float64(tileSize)))
+}
+
+/* PowerHeuristic or BalanceHeuristic, to combine BSDF and light sampling */
+func (opts *SceneOpts) SetHeuristic(heuristic int) {
+	opts.heuristic = heuristic
+}
+
+/* TreeLightSampling or PowerLightSampling, to choose the emitter sampled at each shading point */
+func (opts *SceneOpts) SetLightSampling(lightSampling int) {
+	opts.lightSampling = lightSampling
+}
+
+/* switches to the spectral path tracer : every path carries three wavelengths
+   (hero wavelength sampling), colors of the scene are upsampled to spectra */
+func (opts *SceneOpts) SetSpectral(spectral bool) {
+	opts.spectral = spectral
+}
+
+/* mask of AOV bits (AOVAlbedo...) written beside the beauty image */
+func (opts *SceneOpts) SetAOVs(mask int) {
+	opts.aovs = mask
+}
+
+/* OpenEXR output instead of PNG : exr.Half or exr.Float beauty and colors, exr compression,
+   tile size (0 for scanlines) */
+func (opts *SceneOpts) SetEXR(pixelType int, compression int, tileSize int) {
+	opts.exr = true
+	opts.exrPixelType = pixelType
+	opts.exrCompression = compression
+	opts.exrTileSize = tileSize
+}
+
+/* filters the image once rendered, guided by the albedo, normal and depth buffers */
+func (opts *SceneOpts) SetDenoise(denoise bool) {
+	opts.denoise = denoise
+}
+
+/* reconstruction filter of the pixels, a box of radius 0.5 when not set */
+func (opts *SceneOpts) SetFilter(filter Filter) {
+	opts.filter = filter
+}
+
+/* images are written to output.png or output.exr, result unless set */
+func (opts *SceneOpts) SetOutput(output string) {
+	opts.output = output
+}
+
+/* shutter opening and closing, in frames from the frame rendered : with close after open,
+   every path is traced at an instant of the interval, animated cameras and objects blur */
+func (opts *SceneOpts) SetShutter(open float64, close float64) {
+	opts.shutterOpen = open
+	opts.shutterClose = close
+}
+
+func (opts *SceneOpts) MotionBlur() bool {
+	return opts.shutterClose > opts.shutterOpen
+}
+
+func (scene *Scene) Opts() *SceneOpts {
+	return scene.opts
+}
+
 type Camera struct {
 	position Point3
 	direction Vector3
@@ -89,115 +227,351 @@ func NewWorld(skyEmission Color, groundReflexion Color) *World {
 	return world
 }
 
-func (scene *Scene) Render(epoch int64) {
+/* renders the image and its AOVs to the output files, the error is that of the first file
+   that couldn't be written */
+func (scene *Scene) Render(epoch int64) error {
 	
-	img := image.NewRGBA(image.Rect(0,0,scene.opts.imWidth-1,scene.opts.imHeight-1))
+	scene.pose()
+	window := scene.window()
+	film := NewFilm(window.Width(), window.Height())
+	if scene.opts.filter != nil {
+		film.SetFilter(scene.opts.filter)
+	}
+	if scene.opts.aovs != 0 || scene.opts.denoise {
+		film.EnableAOVs(scene.opts.aovs)
+	}
+	scene.prepare()
 	
-	aspect := float64(scene.opts.imWidth) / float64(scene.opts.imHeight)
+	if scene.opts.adaptive {
+		scene.renderAdaptive(film)
+	} else {
+		scene.samplePixels(film, allPixels(film), scene.opts.iterations)
+	}
 	
-	colors := make([]Color, (scene.opts.imWidth * scene.opts.imHeight))
-	
-//	for x := 0; x < scene.opts.imWidth ; x++ {
-//		for y := 0 ; y < scene.opts.imHeight ; y++ {
-//			xCoeff := ((float64(x) + mrand.Float64()) * 2.0 / float64(scene.opts.imWidth)) - 1.0
-//			yCoeff := ((float64(y) + mrand.Float64()) * 2.0 / float64(scene.opts.imHeight)) - 1.0
-//			offset := MultV(scene.camera.right, xCoeff).AddV(MultV(scene.camera.up, aspect * yCoeff))
-//			var sampleDirection *Vector3 = new(Vector3)
-//			*sampleDirection = UnitizeV(scene.camera.direction.AddV(MultV(offset, scene.camera.tanViewAngle)))
-//			color := scene.getRadiance(&scene.camera.position, &sampleDirection, nil)
-//			colors[x+(scene.opts.imWidth*y)] = *AddColor(*color, colors[x+(scene.opts.imWidth*y)])
-////			color := scene.getRadiance(&scene.camera.position, &sampleDirection, nil)
-////			img.Set(x,y,c.RGBA{color.R(), color.G(), color.B(),255})
-////			fmt.Printf("X=%d | Y=%d\n",x,y)
-//		}
-//	}
-	
-	sem := make(chan int, 4)  // Buffering optional but sensible.
-	
-	for i := 0; i < 4 ; i++ {
-		go func(){
-			for i := 0; i < scene.opts.iterations/4 ; i++ {
-				for x := 0; x < scene.opts.imWidth ; x++ {
-					for y := 0 ; y < scene.opts.imHeight ; y++ {
-						xCoeff := ((float64(x) + mrand.Float64()) * 2.0 / float64(scene.opts.imWidth)) - 1.0
-						yCoeff := ((float64(y) + mrand.Float64()) * 2.0 / float64(scene.opts.imHeight)) - 1.0
-						offset := MultV(scene.camera.right, xCoeff).AddV(MultV(scene.camera.up, aspect * yCoeff))
-						var sampleDirection *Vector3 = new(Vector3)
-						*sampleDirection = UnitizeV(scene.camera.direction.AddV(MultV(offset, scene.camera.tanViewAngle)))
-						colors[x+(scene.opts.imWidth*y)] = *AddColor(*scene.getRadiance(&scene.camera.position, &sampleDirection, nil),colors[x+(scene.opts.imWidth*y)])
-			//			color := scene.getRadiance(&scene.camera.position, &sampleDirection, nil)
-		//				fmt.Printf("X=%d | Y=%d\n",x,y)
+	if scene.opts.denoise {
+		film.Denoise()
+	}
+	
+	if scene.opts.exr {
+		return scene.writeEXR(scene.opts.output+".exr", film)
+	}
+	
+	output := NewColorTransform(scene.opts.working, scene.opts.display, scene.opts.whiteBalance)
+	
+	img := image.NewRGBA(image.Rect(0, 0, film.width, film.height))
+	for xx := 0; xx < film.width ; xx++ {
+			for yy := 0 ; yy < film.height ; yy++ {
+				r, g, b := output.Encode8(film.Color(xx, yy))
+				img.Set(xx,yy,c.RGBA{r, g, b, 255})
+			}
+	}
+	var beauty image.Image = img
+	if scene.opts.composite != nil {
+		beauty = scene.compositeRegion(img)
+	}
+	if err := writePNG(scene.opts.output+".png", beauty, scene.opts.display, scene.opts.working); err != nil {
+		return err
+	}
+	
+	if film.aovs != nil {
+		return scene.writeAOVs(film, output)
+	}
+	return nil
+}
+
+/* what the paths need beyond the posed geometry : identifiers, emitter sampling, spectral output */
+func (scene *Scene) prepare() {
+	scene.indexPrimitives()
+	scene.emitters = newEmitterSampler(scene.opts.lightSampling, scene.sources)
+	scene.spectralOutput = NewColorTransform(LinearRec709, scene.opts.working, 0)
+}
+
+/* samples every listed film pixel index spp times, the pixels are shared out between the workers
+   so that no two goroutines ever accumulate into the same pixel */
+func (scene *Scene) samplePixels(film *Film, pixels []int, spp int) {
+	sem := make(chan int, renderWorkers)  // Buffering optional but sensible.
+	/* film pixels are those of the window, rays go through the image */
+	window := scene.window()
+	
+	for w := 0; w < renderWorkers ; w++ {
+		go func(worker int){
+			for i := worker; i < len(pixels) ; i += renderWorkers {
+				x := pixels[i] % film.width
+				y := pixels[i] / film.width
+				for s := 0; s < spp ; s++ {
+					var wl *Wavelengths
+					if scene.opts.spectral {
+						wl = SampleWavelengths(mrand.Float64())
+					}
+					/* the whole path happens at one instant of the shutter interval */
+					time, camera := 0.0, scene.currentCamera()
+					if scene.opts.MotionBlur() {
+						time = mrand.Float64()
+						camera = scene.cameraAt(time)
+					}
+					fx, fy := float64(x)+mrand.Float64(), float64(y)+mrand.Float64()
+					sampleDirection := scene.cameraRay(camera, float64(window.x0)+fx, float64(window.y0)+fy)
+					var rec *aovRecord
+					if film.aovs != nil {
+						rec = &aovRecord{eye: camera.position}
+					}
+					radiance := scene.toWorking(scene.getRadiance(&camera.position, &sampleDirection, nil, cameraEvent(rec), scene.medium, wl, time), wl)
+					film.AddSample(x, y, fx, fy, radiance)
+					if rec != nil {
+						rec.emission = *scene.toWorking(&rec.emission, wl)
+						rec.direct = *scene.toWorking(&rec.direct, wl)
+						film.aovs.add(x+film.width*y, rec, radiance, scene)
 					}
 				}
 			}
 			sem <- 1
-		}()
+		}(w)
 	}
 	
-	for i := 0; i < 4; i++ {
+	for i := 0; i < renderWorkers; i++ {
         <-sem    // wait for one task to complete
     }
-	
-	for xx := 0; xx < scene.opts.imWidth ; xx++ {
-			for yy := 0 ; yy < scene.opts.imHeight ; yy++ {
-				color := MultC(&colors[xx+(scene.opts.imWidth*yy)],1/float64(scene.opts.iterations))
-				img.Set(xx,yy,c.RGBA{color.R(), color.G(), color.B(),255})
-//				fmt.Printf("X=%d | Y=%d\n",xx,yy)
-			}
+}
+
+/* path values of the beauty and lighting buffers into the working space */
+func (scene *Scene) toWorking(c *Color, wl *Wavelengths) *Color {
+	if wl == nil {
+		return c
 	}
-	f, _ := os.Create("result.png")
-	png.Encode(f,img)
-	f.Close()
+	/* spectra come back as linear Rec.709 */
+	return scene.spectralOutput.Linear(wl.ToRGB(c))
 }
 
-func (scene *Scene) getRadiance(pos *Point3, dir **Vector3, lastHit *Triangle) *Color {
-	var radiance *Color = NewColor(0, 0, 0)
+/* primary ray direction of the camera through film position (fx,fy), in pixels */
+func (scene *Scene) cameraRay(camera *Camera, fx float64, fy float64) *Vector3 {
+	aspect := float64(scene.opts.imWidth) / float64(scene.opts.imHeight)
+	xCoeff := (fx * 2.0 / float64(scene.opts.imWidth)) - 1.0
+	yCoeff := (fy * 2.0 / float64(scene.opts.imHeight)) - 1.0
+	offset := MultV(camera.right, xCoeff).AddV(MultV(camera.up, aspect * yCoeff))
+	var sampleDirection *Vector3 = new(Vector3)
+	*sampleDirection = UnitizeV(camera.direction.AddV(MultV(offset, camera.tanViewAngle)))
+	return sampleDirection
+}
+
+/* paths shorter than rouletteDepth bounces always go on, no path goes past maxDepth : delta
+   lobes of weight one (white conductors, clear dielectrics) would otherwise never end it */
+const (
+	rouletteDepth int = 3
+	maxDepth int = 64
+)
+
+/* the scattering event that chose the direction of a ray : where it happened and the solid angle
+   density of the choice by the BSDF or the phase function. A zero pdf (camera rays, delta lobes)
+   means light sampling couldn't have found the same path : emission is then counted in full */
+type scatterEvent struct {
+	position *Point3
+	pdf float64
+	/* AOV record of the camera path, only along its first two rays */
+	aov *aovRecord
+	/* bounces so far and product of their weights, from the camera */
+	depth int
+	throughput Color
+}
+
+/* event of a camera ray */
+func cameraEvent(aov *aovRecord) scatterEvent {
+	return scatterEvent{nil, 0, aov, 0, *NewColor(1, 1, 1)}
+}
+
+/* event of the next bounce, weight the weight of the bounce. ok is false when russian roulette
+   on the throughput or the depth cap ends the path, otherwise survival is the probability
+   the path had to go on, already divided out of the throughput */
+func (from scatterEvent) next(position *Point3, pdf float64, weight *Color) (event scatterEvent, survival float64, ok bool) {
+	event = scatterEvent{position, pdf, nil, from.depth + 1, *ColorMultC(&from.throughput, weight)}
+	if event.depth > maxDepth {
+		return event, 0, false
+	}
+	survival = 1.0
+	if event.depth > rouletteDepth {
+		r, g, b := event.throughput.RGB()
+		survival = math.Min(1.0, math.Max(r, math.Max(g, b)))
+		if mrand.Float64() >= survival {
+			return event, survival, false
+		}
+	}
+	event.throughput = *MultC(&event.throughput, 1/survival)
+	return event, survival, true
+}
+
+/* medium is the one the ray travels through, nil for vacuum.
+   wl are the wavelengths of a spectral path, nil for RGB rendering.
+   time is the instant of the path in the shutter interval, from 0 to 1 */
+func (scene *Scene) getRadiance(pos *Point3, dir **Vector3, lastHit *Triangle, from scatterEvent, medium *Medium, wl *Wavelengths, time float64) *Color {
 	var hitObject *Triangle
 	var hitPosition *Point3
 	
-	rayBackDirection := NegativeV(**dir)
+	scene.intersection(pos, *dir, lastHit, time, &hitObject, &hitPosition)
 	
-	scene.intersection(pos, *dir, lastHit, &hitObject, &hitPosition)
+	if medium == nil {
+		return scene.getSurfaceRadiance(dir, hitObject, hitPosition, from, medium, wl, time)
+	}
 	
+	tMax := math.Inf(1)
 	if hitObject != nil {
+		toHit := NewVectorFromPoints(*pos, *hitPosition)
+		tMax = math.Sqrt(toHit.DotProduct(*toHit))
+	}
 	
-		sfp := NewSurfacePoint(hitPosition,hitObject)
-		
-		localEmission := map[bool](*Color){true:NewColor(0,0,0), false:sfp.SurfacePointEmission(pos,&rayBackDirection,false)}[lastHit!=nil]
-		
-		emitterSample := scene.sampleEmitters(&rayBackDirection, sfp)
-		
-		/* recursed reflection */
-		var recursedReflection *Color = NewColor(0, 0, 0)
-		
-		/* single hemisphere sample, ideal diffuse BRDF:
-	               reflected = (inradiance * pi) * (cos(in) / pi * color) *
-	                  reflectance
-	            -- reflectance magnitude is 'scaled' by the russian roulette,
-	            cos is importance sampled (both done by SurfacePoint),
-	            and the pi and 1/pi cancel out -- leaving just:
-	               inradiance * reflectance color */
-		var nextDirection *Vector3
-		var color *Color
-		
-		if sfp.SurfacePointNextDirection(&rayBackDirection, &nextDirection, &color) {
-			recursed := scene.getRadiance(sfp.HitPosition(), &nextDirection, sfp.Object())
-			recursedReflection = ColorMultC(recursed, color)
+	/* distance sampling : the ray either scatters inside the medium or reaches the surface */
+	distance, weight, scattered := medium.AtWavelengths(wl).SampleDistance(tMax)
+	
+	if !scattered {
+		stage := from.aov.currentStage()
+		through := from
+		through.throughput = *ColorMultC(&from.throughput, weight)
+		radiance := scene.getSurfaceRadiance(dir, hitObject, hitPosition, through, medium, wl, time)
+		from.aov.attenuate(stage, weight)
+		return ColorMultC(radiance, weight)
+	}
+	/* light scattered by the medium is indirect */
+	from.aov.finish()
+	
+	offset := MultV(**dir, distance)
+	p := NewPointFromVector(pos, &offset)
+	/* the phase function is sampled in getMediumRadiance, its pdf is filled in there */
+	next, survival, ok := from.next(p, 0, weight)
+	if !ok {
+		return NewColor(0, 0, 0)
+	}
+	scattering := scene.getMediumRadiance(p, **dir, next, medium, wl, time)
+	return ColorMultC(scattering, MultC(weight, 1/survival))
+}
+
+/* in-scattered radiance at a point of the medium, for a ray travelling along dir.
+   at is the scattering event of the point */
+func (scene *Scene) getMediumRadiance(p *Point3, dir Vector3, at scatterEvent, medium *Medium, wl *Wavelengths, time float64) *Color {
+	direct := scene.sampleLight(p, nil, medium, wl, time, func(wi *Vector3, li *Color) (*Color, float64) {
+		phase := medium.Phase(dir, *wi)
+		return MultC(li, phase), phase
+	})
+	
+	/* the Henyey-Greenstein phase function is sampled exactly, its weight is one */
+	wi, pdf := medium.SamplePhase(dir)
+	nextDirection := &wi
+	at.pdf = pdf
+	indirect := scene.getRadiance(p, &nextDirection, nil, at, medium, wl, time)
+	
+	return AddColor(*direct, *indirect)
+}
+
+/* radiance leaving the surface hit (if any) back toward the ray origin */
+func (scene *Scene) getSurfaceRadiance(dir **Vector3, hitObject *Triangle, hitPosition *Point3, from scatterEvent, medium *Medium, wl *Wavelengths, time float64) *Color {
+	var radiance *Color = NewColor(0, 0, 0)
+	
+	rayBackDirection := NegativeV(**dir)
+	
+	if hitObject == nil {
+		escaped := scene.escapedRadiance(*dir, from, wl)
+		from.aov.emitted(escaped)
+		return escaped
+	}
+	
+	if IsNullMaterial(hitObject.Material()) {
+		/* boundary of a medium only : the ray goes on unchanged */
+		return scene.getRadiance(hitPosition, dir, hitObject, from, scene.mediumAfter(hitObject.At(time), **dir, medium), wl, time)
+	}
+	
+	sfp := NewSurfacePoint(hitPosition,hitObject.At(time))
+	sfp.SetWavelengths(wl)
+	
+	localEmission := sfp.SurfacePointEmission(hitPosition,&rayBackDirection,false)
+	
+	/* the light sampling strategy could have found this emitter too :
+	   weight its emission against the density light sampling would have had */
+	if from.pdf > 0 && localEmission.IsNotBlack() {
+		lightPdf := scene.emitterPdf(hitObject, from.position) * sfp.SurfacePointSolidAnglePdf(from.position)
+		localEmission = MultC(localEmission, scene.misWeight(from.pdf, lightPdf))
+	}
+	
+	emitterSample := scene.sampleEmitters(&rayBackDirection, sfp, medium, wl, time)
+	
+	first := from.aov.currentStage() == aovFirstSurface
+	if first {
+		from.aov.firstSurface(sfp, localEmission, emitterSample)
+	} else {
+		from.aov.emitted(localEmission)
+	}
+	/* recursed reflection */
+	var recursedReflection *Color = NewColor(0, 0, 0)
+	
+	/* single BSDF sample, the material gives back
+               weight = brdf * cos(in) / pdf
+            -- the path goes on past russian roulette on its throughput with
+            probability survival, leaving just:
+               inradiance * weight / survival
+            for the ideal diffuse BRDF the pi and 1/pi cancel out and the weight
+            is the reflectance color */
+	var nextDirection *Vector3
+	var color *Color
+	
+	if sfp.SurfacePointNextDirection(&rayBackDirection, &nextDirection, &color) {
+		bsdfPdf := sfp.SurfacePointPdf(&rayBackDirection, nextDirection)
+		if next, survival, ok := from.next(sfp.HitPosition(), bsdfPdf, color); ok {
+			if first {
+				next.aov = from.aov
+			}
+			nextMedium := scene.mediumAfter(hitObject.At(time), *nextDirection, medium)
+			recursed := scene.getRadiance(sfp.HitPosition(), &nextDirection, sfp.Object(), next, nextMedium, wl, time)
+			recursedReflection = ColorMultC(recursed, MultC(color, 1/survival))
+			if first {
+				from.aov.bounced(color)
+			}
 		}
-		
-		radiance = AddColor(*localEmission,*emitterSample)
-		radiance = AddColor(*radiance, *recursedReflection)
+	}
+	
+	radiance = AddColor(*localEmission,*emitterSample)
+	radiance = AddColor(*radiance, *recursedReflection)
 	
+	return radiance
+}
+
+/* medium a ray leaving triangle t along dir travels through : the interior of a closed mesh
+   when going inside, the scene medium when going out (media don't nest) */
+func (scene *Scene) mediumAfter(t *Triangle, dir Vector3, current *Medium) *Medium {
+	if t.Interior() == nil {
+		return current
+	}
+	if dir.DotProduct(t.Normal()) < 0 {
+		return t.Interior()
+	}
+	return scene.medium
+}
+
+/* radiance of the lights at infinity seen by a ray leaving the scene */
+func (scene *Scene) escapedRadiance(dir *Vector3, from scatterEvent, wl *Wavelengths) *Color {
+	radiance := NewColor(0, 0, 0)
+	for _, l := range scene.sources {
+		inf, ok := l.(infiniteLight)
+		if !ok {
+			continue
+		}
+		le := inf.Le(dir)
+		if from.pdf > 0 && le.IsNotBlack() {
+			le = MultC(le, scene.misWeight(from.pdf, scene.emitters.pdfOf(l, from.position) * inf.pdfLi(dir)))
+		}
+		radiance = AddColor(*radiance, *wl.Emission(le, l.emission()))
 	}
 	return radiance
 }
 
-func (scene *Scene) intersection(pos *Point3, dir *Vector3, lastHit *Triangle, hitObject **Triangle, hitPosition **Point3) {
-	ray := NewRay(*pos, *dir)
+func (scene *Scene) intersection(pos *Point3, dir *Vector3, lastHit *Triangle, time float64, hitObject **Triangle, hitPosition **Point3) {
+	ray := NewRayAt(*pos, *dir, time)
 	sceneIntersection := RayIntersectsPrimitive(ray, scene.enveloppe)
 	if IsHit(sceneIntersection) {
 		rayBBox := NewBBoxFromIntersection(pos, dir, sceneIntersection)
-		intersections := accelerators.Intersect(scene.tree, rayBBox, ray, lastHit)
+		var intersections []Intersectable
+		/* every triangle may be animated, leaving the static tree empty */
+		if _, empty := scene.tree.(*accelerators.EmptyTree); !empty {
+			intersections = accelerators.Intersect(scene.tree, rayBBox, ray, lastHit)
+		}
+		if scene.animatedTree != nil {
+			intersections = append(intersections, accelerators.Intersect(scene.animatedTree, rayBBox, ray, lastHit)...)
+		}
 //		fmt.Printf("Intersections size : %d\n",len(intersections))
 		intersection := MinIntersections(intersections)
 //		fmt.Printf("adresse : %p\n",dir)
@@ -214,45 +588,92 @@ func (scene *Scene) intersection(pos *Point3, dir *Vector3, lastHit *Triangle, h
 	}
 }
 
-func (scene *Scene) getEmitter(emitterPosition **Point3, emitterObject **Triangle) {
-	if len(scene.lights) > 0 {
-		index := int(math.Floor(mrand.Float64() * float64(len(scene.lights))))
-		index = map[bool]int{true:index, false:len(scene.lights)-1}[index < len(scene.lights)]
-		*emitterObject = scene.lights[index]
-		*emitterPosition = SamplePoint(*emitterObject)
-		
-	} else {
-		*emitterPosition = NewPoint(0,0,0)
-		*emitterObject = nil
+/* probability of the light sampling strategy choosing the emitting triangle for the shading point */
+func (scene *Scene) emitterPdf(emitterObject *Triangle, shadingPoint *Point3) float64 {
+	l, ok := scene.areaLights[emitterObject]
+	if !ok {
+		return 0
 	}
+	return scene.emitters.pdfOf(l, shadingPoint)
 }
 
-func (scene *Scene) sampleEmitters(rayBackDirection *Vector3, sfp *SurfacePoint) *Color {
-	radiance := NewColor(0,0,0)
-	var emitterPosition *Point3
-	var emitterObject *Triangle
+/* fraction of the sampled light reaching p : surfaces occlude it, medium boundaries
+   are crossed and the media in between attenuate it */
+func (scene *Scene) transmittance(p *Point3, lastHit *Triangle, ls *LightSample, medium *Medium, wl *Wavelengths, time float64) *Color {
 	var hitObject *Triangle
 	var hitPosition *Point3
 	
-	scene.getEmitter(&emitterPosition,&emitterObject)
+	tr := NewColor(1, 1, 1)
+	remaining := ls.distance
 	
-	if emitterObject != nil {
-		emitDirection := UnitizeV(*NewVectorFromPoints(*sfp.HitPosition(),*emitterPosition))
+	for {
+		scene.intersection(p,&ls.direction,lastHit,time,&hitObject,&hitPosition)
+		
+		segment := remaining
+		reached := hitObject == nil || hitObject == ls.emitter
+		if !reached {
+			toHit := NewVectorFromPoints(*p, *hitPosition)
+			segment = math.Sqrt(toHit.DotProduct(*toHit))
+			reached = segment >= remaining
+		}
 		
-		scene.intersection(sfp.HitPosition(),&emitDirection,sfp.Object(),&hitObject,&hitPosition)
+		if medium != nil {
+			tr = ColorMultC(tr, medium.AtWavelengths(wl).Transmittance(math.Min(segment, remaining)))
+		}
 		
-		//if hitObject == nil || emitterObject == hitObject {
-			sp := NewSurfacePoint(emitterPosition, emitterObject)
-			backEmitDirection := NegativeV(emitDirection)
-			emissionIn := sp.SurfacePointEmission(sfp.HitPosition(), &backEmitDirection, true)
-			emissionAll := MultC(emissionIn,float64(len(scene.lights)))
-			radiance = sfp.SurfacePointReflection(&emitDirection,emissionAll,rayBackDirection)
-			return radiance
-		//}
+		if reached {
+			return tr
+		}
+		if !IsNullMaterial(hitObject.Material()) {
+			return NewColor(0, 0, 0)
+		}
 		
-		//return radiance
-	} else {
+		medium = scene.mediumAfter(hitObject.At(time), ls.direction, medium)
+		p = hitPosition
+		lastHit = hitObject
+		remaining -= segment
+	}
+}
+
+/* light sampling strategy : one light chosen for p, attenuated up to p, then turned toward the
+   viewer by scatter, which also gives the density the BSDF or phase function would have had
+   for the direction. Weighted by MIS against that density, delta lights excepted */
+func (scene *Scene) sampleLight(p *Point3, lastHit *Triangle, medium *Medium, wl *Wavelengths, time float64, scatter func(wi *Vector3, li *Color) (*Color, float64)) *Color {
+	radiance := NewColor(0,0,0)
+	
+	light, selectionPdf := scene.emitters.sample(mrand.Float64(), p)
+	if light == nil {
 		return radiance
 	}
 	
-}
\ No newline at end of file
+	ls := light.SampleLi(p, time)
+	if ls.pdf <= 0 || !ls.radiance.IsNotBlack() || (lastHit != nil && ls.emitter == lastHit) {
+		return radiance
+	}
+	
+	/* the shadow ray leaves a surface on the side of the light */
+	if lastHit != nil {
+		medium = scene.mediumAfter(lastHit.At(time), ls.direction, medium)
+	}
+	
+	lightPdf := selectionPdf * ls.pdf
+	scattered, scatterPdf := scatter(&ls.direction, MultC(wl.Emission(ls.radiance, light.emission()), 1/lightPdf))
+	if !scattered.IsNotBlack() {
+		return radiance
+	}
+	
+	radiance = ColorMultC(scattered, scene.transmittance(p, lastHit, ls, medium, wl, time))
+	
+	if !light.IsDelta() {
+		radiance = MultC(radiance, scene.misWeight(lightPdf, scatterPdf))
+	}
+	return radiance
+}
+
+/* light sampling strategy : one emitter point, weighted by the MIS heuristic
+   against the BSDF having sampled the same direction */
+func (scene *Scene) sampleEmitters(rayBackDirection *Vector3, sfp *SurfacePoint, medium *Medium, wl *Wavelengths, time float64) *Color {
+	return scene.sampleLight(sfp.HitPosition(), sfp.Object(), medium, wl, time, func(wi *Vector3, li *Color) (*Color, float64) {
+		return sfp.SurfacePointReflection(wi, li, rayBackDirection), sfp.SurfacePointPdf(rayBackDirection, wi)
+	})
+}
@@ -0,0 +1,302 @@
+package exr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+)
+
+/* pixel types */
+const (
+	Half = 1
+	Float = 2
+)
+
+/* compressions */
+const (
+	NoCompression = 0
+	/* zlib, one scanline per block */
+	ZIPSCompression = 2
+	/* zlib, sixteen scanlines per block */
+	ZIPCompression = 3
+)
+
+type Channel struct {
+	Name string
+	Type int
+	/* width * height values, rows from the top */
+	Data []float32
+}
+
+/* OpenEXR writer : single part images, scanline or tiled (one level), half or float
+   channels, uncompressed or zlib (ZIP / ZIPS) compressed. Layers are channel name
+   prefixes, "layer.R", the way multi-layer files are read by compositing tools */
+type Image struct {
+	Width, Height int
+	/* position of the pixels in the display window, of the image size when 0 */
+	X, Y int
+	DisplayWidth, DisplayHeight int
+	Channels []*Channel
+	Compression int
+	/* tile size, 0 for scanlines */
+	TileSize int
+	/* string attributes of the header */
+	Attributes map[string]string
+	/* primaries and white of the RGB channels (rx ry gx gy bx by wx wy), nil for none */
+	Chromaticities []float64
+}
+
+func NewImage(width int, height int) *Image {
+	return &Image{Width: width, Height: height, Attributes: make(map[string]string)}
+}
+
+/* adds a channel named layer.name, or name alone for the default layer */
+func (img *Image) AddChannel(layer string, name string, pixelType int, data []float32) {
+	if layer != "" {
+		name = layer + "." + name
+	}
+	img.Channels = append(img.Channels, &Channel{name, pixelType, data})
+}
+
+func (img *Image) linesPerBlock() int {
+	if img.Compression == ZIPCompression {
+		return 16
+	}
+	return 1
+}
+
+func (c *Channel) bytesPerValue() int {
+	if c.Type == Half {
+		return 2
+	}
+	return 4
+}
+
+type header struct {
+	bytes.Buffer
+}
+
+func (h *header) attribute(name string, kind string, value []byte) {
+	h.WriteString(name)
+	h.WriteByte(0)
+	h.WriteString(kind)
+	h.WriteByte(0)
+	binary.Write(h, binary.LittleEndian, int32(len(value)))
+	h.Write(value)
+}
+
+func le(values ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	return b.Bytes()
+}
+
+func Write(w io.Writer, img *Image) error {
+	if img.Width <= 0 || img.Height <= 0 || len(img.Channels) == 0 {
+		return errors.New("exr : empty image")
+	}
+	channels := append([]*Channel{}, img.Channels...)
+	/* readers expect the channels in alphabetical order */
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	longNames := false
+	for _, c := range channels {
+		if len(c.Data) != img.Width*img.Height {
+			return errors.New("exr : channel " + c.Name + " doesn't match the image size")
+		}
+		longNames = longNames || len(c.Name) > 31
+	}
+	
+	var h header
+	version := int32(2)
+	if img.TileSize > 0 {
+		version |= 0x200
+	}
+	if longNames {
+		version |= 0x400
+	}
+	h.Write(le(int32(20000630), version))
+	
+	var chlist bytes.Buffer
+	for _, c := range channels {
+		chlist.WriteString(c.Name)
+		chlist.WriteByte(0)
+		/* pixel type, pLinear and reserved bytes, x and y sampling */
+		chlist.Write(le(int32(c.Type), uint8(0), uint8(0), uint8(0), uint8(0), int32(1), int32(1)))
+	}
+	chlist.WriteByte(0)
+	h.attribute("channels", "chlist", chlist.Bytes())
+	h.attribute("compression", "compression", []byte{byte(img.Compression)})
+	displayWidth, displayHeight := img.DisplayWidth, img.DisplayHeight
+	if displayWidth == 0 || displayHeight == 0 {
+		displayWidth, displayHeight = img.Width, img.Height
+	}
+	h.attribute("dataWindow", "box2i", le(int32(img.X), int32(img.Y), int32(img.X+img.Width-1), int32(img.Y+img.Height-1)))
+	h.attribute("displayWindow", "box2i", le(int32(0), int32(0), int32(displayWidth-1), int32(displayHeight-1)))
+	h.attribute("lineOrder", "lineOrder", []byte{0})
+	h.attribute("pixelAspectRatio", "float", le(float32(1)))
+	h.attribute("screenWindowCenter", "v2f", le(float32(0), float32(0)))
+	h.attribute("screenWindowWidth", "float", le(float32(1)))
+	if img.TileSize > 0 {
+		/* one level, rounding down */
+		h.attribute("tiles", "tiledesc", le(uint32(img.TileSize), uint32(img.TileSize), uint8(0)))
+	}
+	if len(img.Chromaticities) == 8 {
+		var v []interface{}
+		for _, c := range img.Chromaticities {
+			v = append(v, float32(c))
+		}
+		h.attribute("chromaticities", "chromaticities", le(v...))
+	}
+	names := make([]string, 0, len(img.Attributes))
+	for name := range img.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h.attribute(name, "string", []byte(img.Attributes[name]))
+	}
+	h.WriteByte(0)
+	
+	var chunks [][]byte
+	if img.TileSize > 0 {
+		for ty := 0; ty*img.TileSize < img.Height; ty++ {
+			for tx := 0; tx*img.TileSize < img.Width; tx++ {
+				x0, y0 := tx*img.TileSize, ty*img.TileSize
+				x1 := int(math.Min(float64(x0+img.TileSize), float64(img.Width)))
+				y1 := int(math.Min(float64(y0+img.TileSize), float64(img.Height)))
+				data, err := img.compress(pack(channels, img.Width, x0, x1, y0, y1))
+				if err != nil {
+					return err
+				}
+				chunks = append(chunks, append(le(int32(tx), int32(ty), int32(0), int32(0), int32(len(data))), data...))
+			}
+		}
+	} else {
+		lines := img.linesPerBlock()
+		for y0 := 0; y0 < img.Height; y0 += lines {
+			y1 := int(math.Min(float64(y0+lines), float64(img.Height)))
+			data, err := img.compress(pack(channels, img.Width, 0, img.Width, y0, y1))
+			if err != nil {
+				return err
+			}
+			/* scanline blocks are numbered in display window lines, tiles from the data window corner */
+			chunks = append(chunks, append(le(int32(img.Y+y0), int32(len(data))), data...))
+		}
+	}
+	
+	/* offset table, then the chunks */
+	offset := uint64(h.Len() + 8*len(chunks))
+	for _, c := range chunks {
+		h.Write(le(offset))
+		offset += uint64(len(c))
+	}
+	if _, err := w.Write(h.Bytes()); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, err := w.Write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* pixels of the rectangle, line by line, each line holding the channels one after the other */
+func pack(channels []*Channel, width int, x0 int, x1 int, y0 int, y1 int) []byte {
+	var b bytes.Buffer
+	for y := y0; y < y1; y++ {
+		for _, c := range channels {
+			for x := x0; x < x1; x++ {
+				v := c.Data[x+width*y]
+				if c.Type == Half {
+					binary.Write(&b, binary.LittleEndian, floatToHalf(v))
+				} else {
+					binary.Write(&b, binary.LittleEndian, v)
+				}
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+/* zlib compression after the byte interleaving and delta predictor of the format.
+   Data that doesn't shrink is stored as is, which readers recognize by its size */
+func (img *Image) compress(raw []byte) ([]byte, error) {
+	if img.Compression == NoCompression {
+		return raw, nil
+	}
+	t := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for i := range raw {
+		if i%2 == 0 {
+			t[i/2] = raw[i]
+		} else {
+			t[half+i/2] = raw[i]
+		}
+	}
+	p := int(t[0])
+	for i := 1; i < len(t); i++ {
+		d := int(t[i]) - p + 128 + 256
+		p = int(t[i])
+		t[i] = byte(d)
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	if _, err := zw.Write(t); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if z.Len() >= len(raw) {
+		return raw, nil
+	}
+	return z.Bytes(), nil
+}
+
+/* IEEE 754 half precision, rounded to nearest even, overflowing to infinity */
+func floatToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int((bits >> 23) & 0xff)
+	mantissa := bits & 0x7fffff
+	
+	if exponent == 0xff {
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	}
+	e := exponent - 127 + 15
+	if e >= 0x1f {
+		return sign | 0x7c00
+	}
+	if e <= 0 {
+		if e < -10 {
+			return sign
+		}
+		/* subnormal : the implicit bit becomes explicit */
+		mantissa |= 0x800000
+		shift := uint(14 - e)
+		h := mantissa >> shift
+		rest := mantissa & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rest > halfway || (rest == halfway && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	h := uint32(e)<<10 | mantissa>>13
+	rest := mantissa & 0x1fff
+	if rest > 0x1000 || (rest == 0x1000 && h&1 == 1) {
+		/* a carry into the exponent is still the right rounding */
+		h++
+	}
+	return sign | uint16(h)
+}
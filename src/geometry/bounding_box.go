@@ -38,8 +38,8 @@ func NewBBoxFromIntersection(pos *Point3, dir *Vector3, l []Intersectable) *Boun
 	near := l[0].(*IntersectBBox)
 	far := l[1].(*IntersectBBox)
 	itX := NewInterval(pos.x + (dir.x * near.dist), pos.x + (dir.x * far.dist))
-	itY := NewInterval(pos.y + (dir.y * near.dist), pos.x + (dir.y * far.dist))
-	itZ := NewInterval(pos.z + (dir.z * near.dist), pos.x + (dir.z * far.dist))
+	itY := NewInterval(pos.y + (dir.y * near.dist), pos.y + (dir.y * far.dist))
+	itZ := NewInterval(pos.z + (dir.z * near.dist), pos.z + (dir.z * far.dist))
 	return &BoundingBox{*itX, *itY, *itZ}
 }
 
@@ -0,0 +1,70 @@
+package geometry
+
+/* uv step of the finite differences of bump maps */
+const bumpDelta float64 = 1e-3
+
+/* tangent space normal map : rgb in [0,1] stands for the normal (2r-1, 2g-1, 2b-1)
+   in the frame (dpdu, dpdv, normal). The texture should hold linear values */
+func (t *Triangle) SetNormalMap(texture Texture) {
+	t.normalMap = texture
+}
+
+/* height map : the luminance of the texture times scale displaces the surface along its normal */
+func (t *Triangle) SetBumpMap(texture Texture, scale float64) {
+	t.bumpMap = texture
+	t.bumpScale = scale
+}
+
+func (t *Triangle) height(uv UV, p *Point3) float64 {
+	return t.bumpScale * t.bumpMap.Evaluate(uv, p).Luminance()
+}
+
+/* shading frame at the point p of surface coordinates uv, its normal perturbed
+   by the normal map then the bump map, and kept on the front side of the triangle */
+func (t *Triangle) shadingFrame(uv UV, p *Point3) *Frame {
+	if t.normalMap == nil && t.bumpMap == nil {
+		return NewFrame(t.normal, t.tangent)
+	}
+	n := t.normal
+	dpdu := t.dpdu
+	dpdv := t.dpdv
+
+	if t.normalMap != nil {
+		c := t.normalMap.Evaluate(uv, p)
+		frame := NewFrame(n, dpdu)
+		b := frame.b
+		/* mirrored surface coordinates flip the bitangent */
+		if b.DotProduct(dpdv) < 0 {
+			b = NegativeV(b)
+		}
+		local := MultV(frame.t, 2*c.r-1).AddV(MultV(b, 2*c.g-1)).AddV(MultV(n, 2*c.b-1))
+		if !IsNillVector(local) {
+			n = UnitizeV(local)
+		}
+	}
+
+	if t.bumpMap != nil {
+		h := t.height(uv, p)
+		du := MultV(dpdu, bumpDelta)
+		dv := MultV(dpdv, bumpDelta)
+		pu := NewPointFromVector(p, &du)
+		pv := NewPointFromVector(p, &dv)
+		dhdu := (t.height(UV{uv.u + bumpDelta, uv.v}, pu) - h) / bumpDelta
+		dhdv := (t.height(UV{uv.u, uv.v + bumpDelta}, pv) - h) / bumpDelta
+		/* flat triangle : the normal doesn't vary, only the displacement does */
+		bumped := dpdu.AddV(MultV(n, dhdu)).CrossProduct(dpdv.AddV(MultV(n, dhdv)))
+		if !IsNillVector(bumped) {
+			if bumped.DotProduct(n) < 0 {
+				bumped = NegativeV(bumped)
+			}
+			n = UnitizeV(bumped)
+		}
+	}
+
+	/* a shading normal behind the surface would light it from below, bring it back to
+	   just above the tangent plane */
+	if cos := n.DotProduct(t.normal); cos < 1e-3 {
+		n = UnitizeV(n.AddV(MultV(t.normal, 1e-3-cos)))
+	}
+	return NewFrame(n, dpdu)
+}
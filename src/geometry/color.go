@@ -32,6 +32,15 @@ func (c Color) B() uint8 {
 	return uint8(math.Max(math.Min(255,c.b*255),0))
 }
 
+func (c Color) RGB() (float64, float64, float64) {
+	return c.r, c.g, c.b
+}
+
+/* Rec. 709 luminance of the linear color */
+func (c Color) Luminance() float64 {
+	return 0.2126*c.r + 0.7152*c.g + 0.0722*c.b
+}
+
 func AddColor(c1 Color, c2 Color) *Color {
 	return c1.AddColor(c2)
 }
@@ -0,0 +1,186 @@
+package geometry
+
+import (
+	"math"
+)
+
+const (
+	TransferLinear = iota
+	/* IEC 61966-2-1 piecewise curve, also used by Display P3 */
+	TransferSRGB
+	/* Rec. 709 / Rec. 2020 camera curve */
+	TransferRec709
+)
+
+/* RGB color space : primaries and white point (CIE xy), transfer function of the encoded
+   values and the codes of the PNG cICP chunk (ITU-T H.273) describing it */
+type ColorSpace struct {
+	name string
+	toXYZ, fromXYZ [3][3]float64
+	whiteX, whiteY float64
+	chromaticities [8]float64
+	transfer int
+	cicpPrimaries, cicpTransfer uint8
+}
+
+func NewColorSpace(name string, xr, yr, xg, yg, xb, yb, xw, yw float64, transfer int, cicpPrimaries uint8, cicpTransfer uint8) *ColorSpace {
+	cs := &ColorSpace{name: name, whiteX: xw, whiteY: yw, transfer: transfer, cicpPrimaries: cicpPrimaries, cicpTransfer: cicpTransfer}
+	cs.chromaticities = [8]float64{xr, yr, xg, yg, xb, yb, xw, yw}
+	/* columns are the primaries, scaled so that (1 1 1) is the white of luminance 1 */
+	primaries := [3][3]float64{
+		{xr / yr, xg / yg, xb / yb},
+		{1, 1, 1},
+		{(1 - xr - yr) / yr, (1 - xg - yg) / yg, (1 - xb - yb) / yb}}
+	s := apply3(invert3(primaries), xyToXYZ(xw, yw))
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			cs.toXYZ[i][j] = primaries[i][j] * s[j]
+		}
+	}
+	cs.fromXYZ = invert3(cs.toXYZ)
+	return cs
+}
+
+var LinearRec709 = NewColorSpace("linear Rec.709", 0.64, 0.33, 0.30, 0.60, 0.15, 0.06, 0.3127, 0.3290, TransferLinear, 1, 8)
+var ACEScg = NewColorSpace("ACEScg", 0.713, 0.293, 0.165, 0.830, 0.128, 0.044, 0.32168, 0.33767, TransferLinear, 2, 8)
+var SRGB = NewColorSpace("sRGB", 0.64, 0.33, 0.30, 0.60, 0.15, 0.06, 0.3127, 0.3290, TransferSRGB, 1, 13)
+var DisplayP3 = NewColorSpace("Display P3", 0.680, 0.320, 0.265, 0.690, 0.150, 0.060, 0.3127, 0.3290, TransferSRGB, 12, 13)
+var Rec2020 = NewColorSpace("Rec.2020", 0.708, 0.292, 0.170, 0.797, 0.131, 0.046, 0.3127, 0.3290, TransferRec709, 9, 14)
+
+/* working spaces render in linear values, display spaces encode the output */
+func WorkingSpaceByName(name string) *ColorSpace {
+	switch name {
+	case "srgb", "rec709":
+		return LinearRec709
+	case "acescg":
+		return ACEScg
+	}
+	return nil
+}
+
+func DisplaySpaceByName(name string) *ColorSpace {
+	switch name {
+	case "srgb":
+		return SRGB
+	case "p3":
+		return DisplayP3
+	case "rec2020":
+		return Rec2020
+	}
+	return nil
+}
+
+func (cs *ColorSpace) Name() string {
+	return cs.name
+}
+
+/* xy of the red, green and blue primaries then of the white */
+func (cs *ColorSpace) Chromaticities() []float64 {
+	return cs.chromaticities[:]
+}
+
+/* cICP primaries and transfer codes */
+func (cs *ColorSpace) CICP() (uint8, uint8) {
+	return cs.cicpPrimaries, cs.cicpTransfer
+}
+
+/* non linear encoding of a linear value in [0,1] */
+func (cs *ColorSpace) Encode(v float64) float64 {
+	v = math.Max(0, math.Min(1, v))
+	switch cs.transfer {
+	case TransferSRGB:
+		if v <= 0.0031308 {
+			return 12.92 * v
+		}
+		return 1.055*math.Pow(v, 1/2.4) - 0.055
+	case TransferRec709:
+		if v < 0.018 {
+			return 4.5 * v
+		}
+		return 1.099*math.Pow(v, 0.45) - 0.099
+	}
+	return v
+}
+
+func xyToXYZ(x float64, y float64) [3]float64 {
+	return [3]float64{x / y, 1, (1 - x - y) / y}
+}
+
+func apply3(m [3][3]float64, v [3]float64) [3]float64 {
+	var r [3]float64
+	for i := 0; i < 3; i++ {
+		r[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+	}
+	return r
+}
+
+func mul3(a [3][3]float64, b [3][3]float64) [3][3]float64 {
+	var r [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = a[i][0]*b[0][j] + a[i][1]*b[1][j] + a[i][2]*b[2][j]
+		}
+	}
+	return r
+}
+
+var bradford = [3][3]float64{
+	{0.8951, 0.2664, -0.1614},
+	{-0.7502, 1.7135, 0.0367},
+	{0.0389, -0.0685, 1.0296}}
+
+/* Bradford chromatic adaptation of XYZ colors from one white to the other */
+func chromaticAdaptation(xs, ys, xd, yd float64) [3][3]float64 {
+	src := apply3(bradford, xyToXYZ(xs, ys))
+	dst := apply3(bradford, xyToXYZ(xd, yd))
+	var scale [3][3]float64
+	for i := 0; i < 3; i++ {
+		scale[i][i] = dst[i] / src[i]
+	}
+	return mul3(invert3(bradford), mul3(scale, bradford))
+}
+
+/* chromaticity of a blackbody */
+func blackbodyChromaticity(temperature float64) (float64, float64) {
+	s := NewBlackbody(temperature)
+	var x, y, z float64
+	for lambda := LambdaMin; lambda <= LambdaMax; lambda++ {
+		v := s.Value(lambda)
+		x += v * CIEX(lambda)
+		y += v * CIEY(lambda)
+		z += v * CIEZ(lambda)
+	}
+	return x / (x + y + z), y / (x + y + z)
+}
+
+/* from linear working values to the encoded values of a display space */
+type ColorTransform struct {
+	m [3][3]float64
+	display *ColorSpace
+}
+
+/* whiteBalance is the temperature in kelvins of the light to render as neutral,
+   0 keeps the white of the working space as the white of the display */
+func NewColorTransform(working *ColorSpace, display *ColorSpace, whiteBalance float64) *ColorTransform {
+	xs, ys := working.whiteX, working.whiteY
+	if whiteBalance > 0 {
+		xs, ys = blackbodyChromaticity(whiteBalance)
+	}
+	adaptation := chromaticAdaptation(xs, ys, display.whiteX, display.whiteY)
+	return &ColorTransform{mul3(display.fromXYZ, mul3(adaptation, working.toXYZ)), display}
+}
+
+/* linear values of c in the display space */
+func (t *ColorTransform) Linear(c *Color) *Color {
+	v := apply3(t.m, [3]float64{c.r, c.g, c.b})
+	return NewColor(v[0], v[1], v[2])
+}
+
+/* 8 bits encoded values of c */
+func (t *ColorTransform) Encode8(c *Color) (uint8, uint8, uint8) {
+	l := t.Linear(c)
+	quantize := func(v float64) uint8 {
+		return uint8(math.Floor(t.display.Encode(v)*255 + 0.5))
+	}
+	return quantize(l.r), quantize(l.g), quantize(l.b)
+}
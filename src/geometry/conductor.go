@@ -0,0 +1,111 @@
+package geometry
+
+import (
+	"math"
+	mrand "math/rand"
+)
+
+/* perfect specular reflection, tinted by a constant reflectance */
+type Mirror struct {
+	reflectance Color
+}
+
+func NewMirror(reflectance *Color) *Mirror {
+	return &Mirror{*reflectance}
+}
+
+func (m *Mirror) AtWavelengths(wl *Wavelengths) Material {
+	return &Mirror{*wl.Reflectance(&m.reflectance)}
+}
+
+func (m *Mirror) Albedo() *Color {
+	return NewColor(m.reflectance.r, m.reflectance.g, m.reflectance.b)
+}
+
+/* delta lobe : the sample pdf is only a marker, Eval and Pdf are zero for every pair of directions */
+func (m *Mirror) Sample(wo Vector3) *BSDFSample {
+	return &BSDFSample{Vector3{-wo.x, -wo.y, wo.z}, m.reflectance, 1, true}
+}
+
+func (m *Mirror) Eval(wo Vector3, wi Vector3) *Color {
+	return NewColor(0, 0, 0)
+}
+
+func (m *Mirror) Pdf(wo Vector3, wi Vector3) float64 {
+	return 0
+}
+
+/* metal with complex index of refraction eta + i k per channel,
+   smooth below smoothRoughness and GGX microfacets above */
+type Conductor struct {
+	eta, k Color
+	roughness float64
+	distribution ggx
+}
+
+func NewConductor(eta *Color, k *Color, roughness float64) *Conductor {
+	return &Conductor{*eta, *k, roughness, newGGX(roughness)}
+}
+
+func (m *Conductor) AtWavelengths(wl *Wavelengths) Material {
+	return &Conductor{*wl.Interpolate(&m.eta), *wl.Interpolate(&m.k), m.roughness, m.distribution}
+}
+
+/* reflectance at normal incidence */
+func (m *Conductor) Albedo() *Color {
+	return FresnelConductor(1, &m.eta, &m.k)
+}
+
+func (m *Conductor) isSmooth() bool {
+	return m.roughness < smoothRoughness
+}
+
+func (m *Conductor) Sample(wo Vector3) *BSDFSample {
+	flipped := wo.z < 0
+	if flipped {
+		wo = flipZ(wo)
+	}
+	var sample *BSDFSample
+	
+	if m.isSmooth() {
+		sample = &BSDFSample{Vector3{-wo.x, -wo.y, wo.z}, *FresnelConductor(wo.z, &m.eta, &m.k), 1, true}
+	} else {
+		h := m.distribution.sampleH(mrand.Float64(), mrand.Float64())
+		wi := reflectV(wo, h)
+		if wi.z <= 0 || wo.z <= 0 {
+			return &BSDFSample{wi, *NewColor(0, 0, 0), 0, false}
+		}
+		/* f * cos / pdf with f = D G F / (4 cos(o) cos(i)) and pdf = D cos(h) / (4 |wo.h|) */
+		woh := math.Abs(wo.DotProduct(h))
+		weight := MultC(FresnelConductor(woh, &m.eta, &m.k), m.distribution.G(wo, wi)*woh/(wo.z*h.z))
+		sample = &BSDFSample{wi, *weight, m.distribution.pdfH(h) / (4 * woh), false}
+	}
+	
+	if flipped {
+		sample.Direction = flipZ(sample.Direction)
+	}
+	return sample
+}
+
+func (m *Conductor) Eval(wo Vector3, wi Vector3) *Color {
+	if m.isSmooth() || !sameHemisphere(wo, wi) {
+		return NewColor(0, 0, 0)
+	}
+	if wo.z < 0 {
+		wo, wi = flipZ(wo), flipZ(wi)
+	}
+	h := UnitizeV(wo.AddV(wi))
+	f := FresnelConductor(math.Abs(wo.DotProduct(h)), &m.eta, &m.k)
+	return MultC(f, m.distribution.D(h)*m.distribution.G(wo, wi)/(4*wo.z*wi.z))
+}
+
+func (m *Conductor) Pdf(wo Vector3, wi Vector3) float64 {
+	if m.isSmooth() || !sameHemisphere(wo, wi) {
+		return 0
+	}
+	if wo.z < 0 {
+		wo, wi = flipZ(wo), flipZ(wi)
+	}
+	h := UnitizeV(wo.AddV(wi))
+	return m.distribution.pdfH(h) / (4 * math.Abs(wo.DotProduct(h)))
+}
@@ -0,0 +1,169 @@
+package geometry
+
+import (
+	"math"
+	mrand "math/rand"
+)
+
+/* interface between the outside and a medium of index ior, the normal pointing outside.
+   Reflection and refraction are chosen in proportion to the Fresnel reflectance,
+   with GGX microfacets above smoothRoughness. tint filters the transmitted light.
+   ior is the index at the d line (587.6 nm), an Abbe number makes it vary with the
+   wavelength in the spectral renderer (Cauchy's equation) */
+type Dielectric struct {
+	ior float64
+	roughness float64
+	tint Color
+	distribution ggx
+	abbe float64
+	/* refraction only follows the hero wavelength */
+	dispersed bool
+}
+
+func NewDielectric(ior float64, roughness float64, tint *Color) *Dielectric {
+	return &Dielectric{ior, roughness, *tint, newGGX(roughness), 0, false}
+}
+
+/* Abbe number (nd - 1) / (nF - nC), 0 for no dispersion */
+func (m *Dielectric) SetAbbe(abbe float64) {
+	m.abbe = abbe
+}
+
+/* Cauchy's n(lambda) = a + b / lambda^2 through nd, with the dispersion of the Abbe number */
+func (m *Dielectric) iorAt(lambda float64) float64 {
+	const lambdaD, lambdaF, lambdaC = 587.6, 486.1, 656.3
+	b := (m.ior - 1) / (m.abbe * (1/(lambdaF*lambdaF) - 1/(lambdaC*lambdaC)))
+	a := m.ior - b/(lambdaD*lambdaD)
+	return a + b/(lambda*lambda)
+}
+
+func (m *Dielectric) AtWavelengths(wl *Wavelengths) Material {
+	bound := *m
+	bound.tint = *wl.Reflectance(&m.tint)
+	if m.abbe > 0 {
+		bound.ior = m.iorAt(wl.Hero())
+		bound.dispersed = true
+	}
+	return &bound
+}
+
+/* transmitted light of a dispersive interface : the other wavelengths refract elsewhere,
+   the hero goes on alone and carries the estimate of the three */
+func (m *Dielectric) transmission() *Color {
+	if m.dispersed {
+		return ColorMultC(&m.tint, NewColor(3, 0, 0))
+	}
+	return NewColor(m.tint.r, m.tint.g, m.tint.b)
+}
+
+func (m *Dielectric) Albedo() *Color {
+	return NewColor(m.tint.r, m.tint.g, m.tint.b)
+}
+
+func (m *Dielectric) isSmooth() bool {
+	return m.roughness < smoothRoughness || m.ior == 1
+}
+
+func (m *Dielectric) Sample(wo Vector3) *BSDFSample {
+	if m.isSmooth() {
+		r := FresnelDielectric(wo.z, m.ior)
+		if mrand.Float64() < r {
+			return &BSDFSample{Vector3{-wo.x, -wo.y, wo.z}, *NewColor(1, 1, 1), 1, true}
+		}
+		wi, etap, ok := refract(wo, Vector3{0, 0, 1}, m.ior)
+		if !ok {
+			return &BSDFSample{wi, *NewColor(0, 0, 0), 0, true}
+		}
+		/* radiance is compressed by the squared index ratio when entering a denser medium */
+		return &BSDFSample{wi, *MultC(m.transmission(), 1/(etap*etap)), 1, true}
+	}
+	
+	invalid := &BSDFSample{Vector3{}, *NewColor(0, 0, 0), 0, false}
+	wm := m.distribution.sampleH(mrand.Float64(), mrand.Float64())
+	if wo.DotProduct(wm)*wo.z <= 0 {
+		return invalid
+	}
+	r := FresnelDielectric(wo.DotProduct(wm), m.ior)
+	
+	var wi Vector3
+	if mrand.Float64() < r {
+		wi = reflectV(wo, wm)
+		if !sameHemisphere(wo, wi) {
+			return invalid
+		}
+	} else {
+		var ok bool
+		wi, _, ok = refract(wo, wm, m.ior)
+		if !ok || sameHemisphere(wo, wi) || wi.z == 0 {
+			return invalid
+		}
+	}
+	
+	pdf := m.Pdf(wo, wi)
+	if pdf <= 0 {
+		return invalid
+	}
+	f := m.Eval(wo, wi)
+	return &BSDFSample{wi, *MultC(f, math.Abs(wi.z)/pdf), pdf, false}
+}
+
+/* generalized half vector of the pair, on the outside, with the index ratio of the path */
+func (m *Dielectric) halfVector(wo Vector3, wi Vector3) (Vector3, float64, bool) {
+	etap := 1.0
+	if !sameHemisphere(wo, wi) {
+		if wo.z > 0 {
+			etap = m.ior
+		} else {
+			etap = 1 / m.ior
+		}
+	}
+	wm := MultV(wi, etap).AddV(wo)
+	if wi.z == 0 || wo.z == 0 || IsNillVector(wm) {
+		return wm, etap, false
+	}
+	wm = UnitizeV(wm)
+	if wm.z < 0 {
+		wm = NegativeV(wm)
+	}
+	/* discard back-facing microfacets */
+	if wm.DotProduct(wi)*wi.z < 0 || wm.DotProduct(wo)*wo.z < 0 {
+		return wm, etap, false
+	}
+	return wm, etap, true
+}
+
+func (m *Dielectric) Eval(wo Vector3, wi Vector3) *Color {
+	if m.isSmooth() {
+		return NewColor(0, 0, 0)
+	}
+	wm, etap, ok := m.halfVector(wo, wi)
+	if !ok {
+		return NewColor(0, 0, 0)
+	}
+	f := FresnelDielectric(wo.DotProduct(wm), m.ior)
+	d := m.distribution.D(wm) * m.distribution.G(wo, wi)
+	if sameHemisphere(wo, wi) {
+		v := d * f / math.Abs(4*wi.z*wo.z)
+		return NewColor(v, v, v)
+	}
+	denom := wi.DotProduct(wm) + wo.DotProduct(wm)/etap
+	denom = denom * denom * wi.z * wo.z
+	ft := d * (1 - f) * math.Abs(wi.DotProduct(wm)*wo.DotProduct(wm)/denom) / (etap * etap)
+	return MultC(m.transmission(), ft)
+}
+
+func (m *Dielectric) Pdf(wo Vector3, wi Vector3) float64 {
+	if m.isSmooth() {
+		return 0
+	}
+	wm, etap, ok := m.halfVector(wo, wi)
+	if !ok {
+		return 0
+	}
+	r := FresnelDielectric(wo.DotProduct(wm), m.ior)
+	if sameHemisphere(wo, wi) {
+		return m.distribution.pdfH(wm) / (4 * math.Abs(wo.DotProduct(wm))) * r
+	}
+	denom := wi.DotProduct(wm) + wo.DotProduct(wm)/etap
+	return m.distribution.pdfH(wm) * math.Abs(wi.DotProduct(wm)) / (denom * denom) * (1 - r)
+}
@@ -0,0 +1,37 @@
+package geometry
+
+import (
+	"math"
+)
+
+/* orthonormal shading frame, z along the normal */
+type Frame struct {
+	t, b, n Vector3
+}
+
+/* n unit, t any vector not parallel to n */
+func NewFrame(n Vector3, t Vector3) *Frame {
+	tangent := t.AddV(MultV(n, -n.DotProduct(t)))
+	if tangent.length() < 1e-12 {
+		if math.Abs(n.x) > 0.9 {
+			tangent = *NewVector(0, 1, 0)
+		} else {
+			tangent = *NewVector(1, 0, 0)
+		}
+		tangent = tangent.AddV(MultV(n, -n.DotProduct(tangent)))
+	}
+	tangent = UnitizeV(tangent)
+	return &Frame{tangent, n.CrossProduct(tangent), n}
+}
+
+func (f *Frame) Normal() Vector3 {
+	return f.n
+}
+
+func (f *Frame) ToLocal(v Vector3) Vector3 {
+	return Vector3{v.DotProduct(f.t), v.DotProduct(f.b), v.DotProduct(f.n)}
+}
+
+func (f *Frame) ToWorld(v Vector3) Vector3 {
+	return MultV(f.t, v.x).AddV(MultV(f.b, v.y)).AddV(MultV(f.n, v.z))
+}
@@ -0,0 +1,66 @@
+package geometry
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+/* unpolarized Fresnel reflectance of a conductor of complex index eta + i k,
+   for the cosine of the incident angle */
+func FresnelComplex(cosI float64, eta float64, k float64) float64 {
+	cosI = math.Max(0, math.Min(1, cosI))
+	etaC := complex(eta, k)
+	sin2I := complex(1-cosI*cosI, 0)
+	sin2T := sin2I / (etaC * etaC)
+	cosT := cmplx.Sqrt(1 - sin2T)
+	ci := complex(cosI, 0)
+	rParl := (etaC*ci - cosT) / (etaC*ci + cosT)
+	rPerp := (ci - etaC*cosT) / (ci + etaC*cosT)
+	return (norm2(rParl) + norm2(rPerp)) / 2
+}
+
+func norm2(c complex128) float64 {
+	return real(c)*real(c) + imag(c)*imag(c)
+}
+
+/* per channel conductor reflectance */
+func FresnelConductor(cosI float64, eta *Color, k *Color) *Color {
+	return NewColor(FresnelComplex(cosI, eta.r, k.r), FresnelComplex(cosI, eta.g, k.g), FresnelComplex(cosI, eta.b, k.b))
+}
+
+/* unpolarized Fresnel reflectance of a dielectric interface of relative index eta (inside over outside),
+   cosI negative when the incident direction comes from inside */
+func FresnelDielectric(cosI float64, eta float64) float64 {
+	cosI = math.Max(-1, math.Min(1, cosI))
+	if cosI < 0 {
+		eta = 1 / eta
+		cosI = -cosI
+	}
+	sin2T := (1 - cosI*cosI) / (eta * eta)
+	if sin2T >= 1 {
+		/* total internal reflection */
+		return 1
+	}
+	cosT := math.Sqrt(1 - sin2T)
+	rParl := (eta*cosI - cosT) / (eta*cosI + cosT)
+	rPerp := (cosI - eta*cosT) / (cosI + eta*cosT)
+	return (rParl*rParl + rPerp*rPerp) / 2
+}
+
+/* refraction of wi (pointing away from the surface) through the interface of normal n and
+   relative index eta, gives back the transmitted direction and the index actually crossed,
+   false under total internal reflection */
+func refract(wi Vector3, n Vector3, eta float64) (Vector3, float64, bool) {
+	cosI := n.DotProduct(wi)
+	if cosI < 0 {
+		eta = 1 / eta
+		cosI = -cosI
+		n = NegativeV(n)
+	}
+	sin2T := math.Max(0, 1-cosI*cosI) / (eta * eta)
+	if sin2T >= 1 {
+		return Vector3{}, eta, false
+	}
+	cosT := math.Sqrt(1 - sin2T)
+	return MultV(NegativeV(wi), 1/eta).AddV(MultV(n, cosI/eta-cosT)), eta, true
+}
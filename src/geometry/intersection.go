@@ -71,6 +71,14 @@ func IsHit(l [] Intersectable) bool {
 func MinIntersections(l []Intersectable) Intersectable {
 	var result Intersectable
 	
+	/* a tree of one triangle gives one intersection, no tree at all none */
+	switch len(l) {
+	case 0:
+		return &Miss{}
+	case 1:
+		return l[0]
+	}
+	
 	min := func (i1 Intersectable, i2 Intersectable) Intersectable {
 		var result Intersectable
 		switch i1.(type) {
@@ -0,0 +1,125 @@
+package geometry
+
+import (
+	"math"
+	mrand "math/rand"
+)
+
+/* result of sampling a BSDF : the chosen direction, the throughput weight f * |cos| / pdf,
+   the solid angle density of the choice and whether it came from a delta lobe */
+type BSDFSample struct {
+	Direction Vector3
+	Weight Color
+	Pdf float64
+	Specular bool
+}
+
+/* scattering of a surface, in the local shading frame (z along the normal) :
+   wo points toward the viewer, wi toward the light, both away from the surface.
+   Delta lobes are only reachable through Sample (Specular set), Eval and Pdf ignore them */
+type Material interface {
+	Sample(wo Vector3) *BSDFSample
+	Eval(wo Vector3, wi Vector3) *Color
+	Pdf(wo Vector3, wi Vector3) float64
+}
+
+/* materials whose parameters vary over the surface : At gives the material of one point */
+type TexturedMaterial interface {
+	At(uv UV, p *Point3) Material
+}
+
+/* material of the point p of surface coordinates uv */
+func MaterialAt(m Material, uv UV, p *Point3) Material {
+	if tm, ok := m.(TexturedMaterial); ok {
+		return tm.At(uv, p)
+	}
+	return m
+}
+
+/* materials with colors : AtWavelengths gives the material seen by a spectral path */
+type SpectralMaterial interface {
+	AtWavelengths(wl *Wavelengths) Material
+}
+
+/* material of a spectral path, m itself for the RGB renderer */
+func MaterialAtWavelengths(m Material, wl *Wavelengths) Material {
+	if sm, ok := m.(SpectralMaterial); ok && wl != nil {
+		return sm.AtWavelengths(wl)
+	}
+	return m
+}
+
+/* materials able to tell how much light they give back overall, for the albedo buffer */
+type AlbedoMaterial interface {
+	Albedo() *Color
+}
+
+func sameHemisphere(wo Vector3, wi Vector3) bool {
+	return wo.z*wi.z > 0
+}
+
+/* cosine-weighted direction in the hemisphere of z */
+func cosineHemisphere(r1 float64, r2 float64) Vector3 {
+	twopr1 := math.Pi * 2.0 * r1
+	sr2 := math.Sqrt(r2)
+	return Vector3{math.Cos(twopr1) * sr2, math.Sin(twopr1) * sr2, math.Sqrt(1.0 - (sr2 * sr2))}
+}
+
+/* ideal diffuse reflection, from both sides of the surface */
+type Lambertian struct {
+	reflectance Color
+	/* reflectance varying over the surface, nil for a constant one */
+	texture Texture
+}
+
+func NewLambertian(reflectance *Color) *Lambertian {
+	return &Lambertian{*reflectance, nil}
+}
+
+/* the unbound material reflects the texture average */
+func NewTexturedLambertian(texture Texture) *Lambertian {
+	return &Lambertian{*texture.Average(), texture}
+}
+
+func (m *Lambertian) Textured() bool {
+	return m.texture != nil
+}
+
+func (m *Lambertian) At(uv UV, p *Point3) Material {
+	if m.texture == nil {
+		return m
+	}
+	return &Lambertian{*m.texture.Evaluate(uv, p), nil}
+}
+
+func (m *Lambertian) AtWavelengths(wl *Wavelengths) Material {
+	return &Lambertian{*wl.Reflectance(&m.reflectance), m.texture}
+}
+
+func (m *Lambertian) Albedo() *Color {
+	return NewColor(m.reflectance.r, m.reflectance.g, m.reflectance.b)
+}
+
+func (m *Lambertian) Sample(wo Vector3) *BSDFSample {
+	wi := cosineHemisphere(mrand.Float64(), mrand.Float64())
+	/* put the direction on the viewer side of surface (preventing transmission) */
+	if wo.z < 0.0 {
+		wi.z = -wi.z
+	}
+	/* f * cos / pdf = (R / pi) * cos / (cos / pi) */
+	return &BSDFSample{wi, m.reflectance, math.Abs(wi.z) / math.Pi, false}
+}
+
+func (m *Lambertian) Eval(wo Vector3, wi Vector3) *Color {
+	if !sameHemisphere(wo, wi) {
+		return NewColor(0, 0, 0)
+	}
+	return MultC(&m.reflectance, 1/math.Pi)
+}
+
+func (m *Lambertian) Pdf(wo Vector3, wi Vector3) float64 {
+	if !sameHemisphere(wo, wi) {
+		return 0
+	}
+	return math.Abs(wi.z) / math.Pi
+}
@@ -0,0 +1,104 @@
+package geometry
+
+import (
+	"math"
+	mrand "math/rand"
+)
+
+/* homogeneous participating medium : absorption and scattering coefficients per unit length,
+   Henyey-Greenstein phase function of asymmetry g (g > 0 scatters forward) */
+type Medium struct {
+	sigmaA, sigmaS, sigmaT Color
+	g float64
+}
+
+func NewMedium(sigmaA *Color, sigmaS *Color, g float64) *Medium {
+	return &Medium{*sigmaA, *sigmaS, *AddColor(*sigmaA, *sigmaS), math.Max(-0.99, math.Min(0.99, g))}
+}
+
+/* the medium seen by a spectral path, m itself for the RGB renderer */
+func (m *Medium) AtWavelengths(wl *Wavelengths) *Medium {
+	if m == nil || wl == nil {
+		return m
+	}
+	sigmaA := wl.Interpolate(&m.sigmaA)
+	sigmaS := wl.Interpolate(&m.sigmaS)
+	return &Medium{*sigmaA, *sigmaS, *AddColor(*sigmaA, *sigmaS), m.g}
+}
+
+func (m *Medium) Transmittance(distance float64) *Color {
+	return NewColor(attenuation(m.sigmaT.r, distance), attenuation(m.sigmaT.g, distance), attenuation(m.sigmaT.b, distance))
+}
+
+/* exp(-sigma * distance), keeping one for a non attenuating channel at infinite distance */
+func attenuation(sigma float64, distance float64) float64 {
+	if sigma == 0 {
+		return 1
+	}
+	return math.Exp(-sigma * distance)
+}
+
+/* samples the distance to the next interaction before tMax, using the channel mean of sigmaT :
+   gives back the distance, the weight (transmittance, times sigmaS when scattered, over the density)
+   and whether the ray scattered in the medium rather than reaching tMax */
+func (m *Medium) SampleDistance(tMax float64) (float64, *Color, bool) {
+	sigma := (m.sigmaT.r + m.sigmaT.g + m.sigmaT.b) / 3
+	if sigma <= 0 {
+		return tMax, NewColor(1, 1, 1), false
+	}
+	t := -math.Log(1-mrand.Float64()) / sigma
+	if t < tMax {
+		tr := m.Transmittance(t)
+		pdf := sigma * math.Exp(-sigma*t)
+		return t, MultC(ColorMultC(tr, &m.sigmaS), 1/pdf), true
+	}
+	tr := m.Transmittance(tMax)
+	return tMax, MultC(tr, 1/math.Exp(-sigma*tMax)), false
+}
+
+/* Henyey-Greenstein density of turning from the propagation direction dir into wi */
+func (m *Medium) Phase(dir Vector3, wi Vector3) float64 {
+	cosTheta := dir.DotProduct(wi)
+	denom := 1 + m.g*m.g - 2*m.g*cosTheta
+	return (1 - m.g*m.g) / (4 * math.Pi * denom * math.Sqrt(denom))
+}
+
+/* new direction for a ray scattered while travelling along dir, and its density
+   (the phase function is its own density, the throughput weight is one) */
+func (m *Medium) SamplePhase(dir Vector3) (Vector3, float64) {
+	var cosTheta float64
+	u := mrand.Float64()
+	if math.Abs(m.g) < 1e-3 {
+		cosTheta = 1 - 2*u
+	} else {
+		sq := (1 - m.g*m.g) / (1 - m.g + 2*m.g*u)
+		cosTheta = (1 + m.g*m.g - sq*sq) / (2 * m.g)
+	}
+	cosTheta = math.Max(-1, math.Min(1, cosTheta))
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * mrand.Float64()
+	frame := NewFrame(dir, *NewVector(1, 0, 0))
+	wi := frame.ToWorld(Vector3{sinTheta * math.Cos(phi), sinTheta * math.Sin(phi), cosTheta})
+	return wi, m.Phase(dir, wi)
+}
+
+/* boundary that only delimits a medium : rays cross it unchanged */
+type NullMaterial struct {
+}
+
+func (m *NullMaterial) Sample(wo Vector3) *BSDFSample {
+	return &BSDFSample{NegativeV(wo), *NewColor(1, 1, 1), 1, true}
+}
+
+func (m *NullMaterial) Eval(wo Vector3, wi Vector3) *Color {
+	return NewColor(0, 0, 0)
+}
+
+func (m *NullMaterial) Pdf(wo Vector3, wi Vector3) float64 {
+	return 0
+}
+
+func IsNullMaterial(m Material) bool {
+	_, ok := m.(*NullMaterial)
+	return ok
+}
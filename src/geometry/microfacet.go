@@ -0,0 +1,63 @@
+package geometry
+
+import (
+	"math"
+)
+
+/* Trowbridge-Reitz (GGX) distribution of microfacet normals, alpha is the squared roughness */
+type ggx struct {
+	alpha float64
+}
+
+func newGGX(roughness float64) ggx {
+	return ggx{math.Max(roughness*roughness, 1e-4)}
+}
+
+/* below this roughness the surface is treated as perfectly smooth */
+const smoothRoughness float64 = 1e-2
+
+func (d ggx) D(h Vector3) float64 {
+	if h.z <= 0 {
+		return 0
+	}
+	a2 := d.alpha * d.alpha
+	t := h.z*h.z*(a2-1) + 1
+	return a2 / (math.Pi * t * t)
+}
+
+func (d ggx) lambda(w Vector3) float64 {
+	cos2 := w.z * w.z
+	if cos2 == 0 {
+		return math.Inf(1)
+	}
+	tan2 := (1 - cos2) / cos2
+	return (-1 + math.Sqrt(1+d.alpha*d.alpha*tan2)) / 2
+}
+
+/* height-correlated Smith masking-shadowing */
+func (d ggx) G(wo Vector3, wi Vector3) float64 {
+	return 1 / (1 + d.lambda(wo) + d.lambda(wi))
+}
+
+/* microfacet normal distributed as D(h) cos(h) */
+func (d ggx) sampleH(r1 float64, r2 float64) Vector3 {
+	tan2 := d.alpha * d.alpha * r1 / (1 - r1)
+	cosTheta := 1 / math.Sqrt(1+tan2)
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * r2
+	return Vector3{sinTheta * math.Cos(phi), sinTheta * math.Sin(phi), cosTheta}
+}
+
+/* density of sampleH, in microfacet normal solid angle */
+func (d ggx) pdfH(h Vector3) float64 {
+	return d.D(h) * math.Abs(h.z)
+}
+
+func reflectV(wo Vector3, h Vector3) Vector3 {
+	return MultV(h, 2*wo.DotProduct(h)).AddV(NegativeV(wo))
+}
+
+/* materials seen from the back side behave as from the front side */
+func flipZ(v Vector3) Vector3 {
+	return Vector3{v.x, v.y, -v.z}
+}
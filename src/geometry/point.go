@@ -15,6 +15,16 @@ func NewPoint(x float64, y float64, z float64) *Point3 {
 	return p
 }
 
+func (p Point3) X() float64 {
+	return p.x
+}
+func (p Point3) Y() float64 {
+	return p.y
+}
+func (p Point3) Z() float64 {
+	return p.z
+}
+
 func NewPointFromVector(pos *Point3, v *Vector3) *Point3 {
 	return &Point3{pos.x + v.x, pos.y + v.y, pos.z + v.z}
 }
\ No newline at end of file
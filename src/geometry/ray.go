@@ -7,9 +7,15 @@ import (
 type Ray struct {
 	origin Point3
 	direction Vector3
+	/* instant in the shutter interval, 0 at its opening and 1 at its closing */
+	time float64
 }
 
 func NewRay(origin Point3, direction Vector3) *Ray {
-	r := &Ray{origin, direction}
+	r := &Ray{origin, direction, 0}
 	return r
+}
+
+func NewRayAt(origin Point3, direction Vector3, time float64) *Ray {
+	return &Ray{origin, direction, time}
 }
\ No newline at end of file
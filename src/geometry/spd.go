@@ -0,0 +1,134 @@
+package geometry
+
+import (
+	"math"
+	"sort"
+)
+
+/* spectral power distribution, wavelengths in nanometers */
+type Spectrum interface {
+	Value(lambda float64) float64
+}
+
+/* Planck's law at temperature kelvins, relative values */
+type Blackbody struct {
+	temperature float64
+}
+
+func NewBlackbody(temperature float64) *Blackbody {
+	return &Blackbody{math.Max(temperature, 1)}
+}
+
+func (s *Blackbody) Value(lambda float64) float64 {
+	const h, c, kb = 6.62606957e-34, 299792458.0, 1.3806488e-23
+	l := lambda * 1e-9
+	return 2 * h * c * c / (l * l * l * l * l * (math.Exp(h*c/(l*kb*s.temperature)) - 1))
+}
+
+/* measured distribution, linearly interpolated between its samples and zero outside */
+type TabulatedSpectrum struct {
+	lambdas, values []float64
+}
+
+func NewTabulatedSpectrum(lambdas []float64, values []float64) *TabulatedSpectrum {
+	s := &TabulatedSpectrum{append([]float64{}, lambdas...), append([]float64{}, values...)}
+	sort.Sort(s)
+	return s
+}
+
+func (s *TabulatedSpectrum) Len() int {
+	return len(s.lambdas)
+}
+
+func (s *TabulatedSpectrum) Less(i, j int) bool {
+	return s.lambdas[i] < s.lambdas[j]
+}
+
+func (s *TabulatedSpectrum) Swap(i, j int) {
+	s.lambdas[i], s.lambdas[j] = s.lambdas[j], s.lambdas[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
+
+func (s *TabulatedSpectrum) Value(lambda float64) float64 {
+	n := len(s.lambdas)
+	if n == 0 || lambda < s.lambdas[0] || lambda > s.lambdas[n-1] {
+		return 0
+	}
+	i := sort.SearchFloat64s(s.lambdas, lambda)
+	if s.lambdas[i] == lambda || i == 0 {
+		return s.values[i]
+	}
+	t := (lambda - s.lambdas[i-1]) / (s.lambdas[i] - s.lambdas[i-1])
+	return s.values[i-1] + t*(s.values[i]-s.values[i-1])
+}
+
+/* maximum luminous efficacy, lumens per watt */
+const luminousEfficacy float64 = 683
+
+/* emission given by a spectrum rather than an RGB triple. The spectrum is scaled into the
+   units of the renderer, where an RGB luminance of 1 is 1 cd/m² (1 cd for a point light,
+   1 lux for the sun). rgb is its value for the RGB renderer */
+type SpectralEmission struct {
+	spectrum Spectrum
+	scale float64
+	rgb Color
+}
+
+/* s shaped emission of luminance (cd/m², cd or lux) */
+func NewPhotometricEmission(s Spectrum, luminance float64) *SpectralEmission {
+	e := &SpectralEmission{s, 1, Color{}}
+	if y := e.integrate().Luminance(); y > 0 {
+		e.scale = luminance / y
+	}
+	e.rgb = *e.integrate()
+	return e
+}
+
+/* s shaped emission of radiometric value (W/(sr m²), W/sr or W/m²) over the visible range */
+func NewRadiometricEmission(s Spectrum, radiance float64) *SpectralEmission {
+	total := 0.0
+	for lambda := LambdaMin; lambda <= LambdaMax; lambda++ {
+		total += s.Value(lambda)
+	}
+	e := &SpectralEmission{s, 0, Color{}}
+	if total > 0 {
+		/* watts to the luminance units : Y = 683 * integral of s * ybar */
+		e.scale = radiance / total * luminousEfficacy * cieYIntegral
+	}
+	e.rgb = *e.integrate()
+	return e
+}
+
+/* linear sRGB of the scaled spectrum, normalized like Wavelengths.ToRGB */
+func (e *SpectralEmission) integrate() *Color {
+	var x, y, z float64
+	for lambda := LambdaMin; lambda <= LambdaMax; lambda++ {
+		v := e.Value(lambda)
+		x += v * CIEX(lambda)
+		y += v * CIEY(lambda)
+		z += v * CIEZ(lambda)
+	}
+	return XYZToLinearSRGB(x/cieYIntegral, y/cieYIntegral, z/cieYIntegral)
+}
+
+func (e *SpectralEmission) Value(lambda float64) float64 {
+	return e.scale * e.spectrum.Value(lambda)
+}
+
+func (e *SpectralEmission) RGB() *Color {
+	return NewColor(e.rgb.r, e.rgb.g, e.rgb.b)
+}
+
+/* emitted radiance c at the path wavelengths. c comes from an emitter of spectral emission e
+   (nil for an RGB emitter), and is then a multiple of e's RGB value : the multiple carries over */
+func (wl *Wavelengths) Emission(c *Color, e *SpectralEmission) *Color {
+	if wl == nil || e == nil {
+		return wl.Radiance(c)
+	}
+	y := e.rgb.Luminance()
+	if y <= 0 {
+		return NewColor(0, 0, 0)
+	}
+	k := c.Luminance() / y
+	return NewColor(k*e.Value(wl[0]), k*e.Value(wl[1]), k*e.Value(wl[2]))
+}
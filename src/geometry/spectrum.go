@@ -0,0 +1,161 @@
+package geometry
+
+import (
+	"math"
+)
+
+/* visible range sampled by the spectral renderer, in nanometers */
+const LambdaMin float64 = 360
+const LambdaMax float64 = 830
+
+/* wavelengths carried by a spectral path : the hero wavelength and two others evenly
+   rotated over the visible range. The radiance of the path at each of them travels in the
+   r, g and b channels of a Color. A nil *Wavelengths stands for the RGB renderer */
+type Wavelengths [3]float64
+
+func SampleWavelengths(u float64) *Wavelengths {
+	var wl Wavelengths
+	span := LambdaMax - LambdaMin
+	for i := range wl {
+		wl[i] = LambdaMin + math.Mod(u*span+float64(i)*span/3, span)
+	}
+	return &wl
+}
+
+/* piecewise gaussian of the CIE matching function fits */
+func lobe(x float64, mu float64, sigma1 float64, sigma2 float64) float64 {
+	sigma := sigma2
+	if x < mu {
+		sigma = sigma1
+	}
+	t := (x - mu) / sigma
+	return math.Exp(-0.5 * t * t)
+}
+
+/* CIE 1931 2° color matching functions, multi-lobe fit of Wyman, Sloan and Shirley */
+func CIEX(lambda float64) float64 {
+	return 1.056*lobe(lambda, 599.8, 37.9, 31.0) + 0.362*lobe(lambda, 442.0, 16.0, 26.7) - 0.065*lobe(lambda, 501.1, 20.4, 26.2)
+}
+
+func CIEY(lambda float64) float64 {
+	return 0.821*lobe(lambda, 568.8, 46.9, 40.5) + 0.286*lobe(lambda, 530.9, 16.3, 31.1)
+}
+
+func CIEZ(lambda float64) float64 {
+	return 1.217*lobe(lambda, 437.0, 11.8, 36.0) + 0.681*lobe(lambda, 459.0, 26.0, 13.8)
+}
+
+/* linear sRGB (D65) of a CIE XYZ color */
+func XYZToLinearSRGB(x float64, y float64, z float64) *Color {
+	return NewColor(3.2404542*x-1.5371385*y-0.4985314*z,
+		-0.9692660*x+1.8760108*y+0.0415560*z,
+		0.0556434*x-0.2040259*y+1.0572252*z)
+}
+
+/* smooth basis the RGB triples are upsampled on : blue, green and red gaussians
+   normalized into a partition of unity, so that reflectances in [0,1] stay in [0,1]
+   and grays become flat spectra */
+func rgbBasis(lambda float64) (float64, float64, float64) {
+	r := lobe(lambda, 620, 40, 40)
+	g := lobe(lambda, 540, 35, 35)
+	b := lobe(lambda, 450, 30, 30)
+	sum := r + g + b
+	return r / sum, g / sum, b / sum
+}
+
+var cieYIntegral float64
+
+/* inverse of the matrix giving the linear sRGB of the three basis spectra :
+   emissions are upsampled through it so that they come back to their RGB value */
+var emissionToBasis [3][3]float64
+
+func init() {
+	var m [3][3]float64
+	for lambda := LambdaMin; lambda <= LambdaMax; lambda++ {
+		cieYIntegral += CIEY(lambda)
+	}
+	for lambda := LambdaMin; lambda <= LambdaMax; lambda++ {
+		r, g, b := rgbBasis(lambda)
+		x, y, z := CIEX(lambda), CIEY(lambda), CIEZ(lambda)
+		for k, w := range [3]float64{r, g, b} {
+			c := XYZToLinearSRGB(w*x/cieYIntegral, w*y/cieYIntegral, w*z/cieYIntegral)
+			m[0][k] += c.r
+			m[1][k] += c.g
+			m[2][k] += c.b
+		}
+	}
+	emissionToBasis = invert3(m)
+}
+
+func invert3(m [3][3]float64) [3][3]float64 {
+	var inv [3][3]float64
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) - m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) + m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			/* cofactor of (j,i), cyclic indices keep the signs */
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			inv[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return inv
+}
+
+/* values of the spectrum of coordinates (r g b) on the basis at the path wavelengths */
+func (wl *Wavelengths) basis(r float64, g float64, b float64) *Color {
+	var v [3]float64
+	for i, lambda := range wl {
+		br, bg, bb := rgbBasis(lambda)
+		v[i] = r*br + g*bg + b*bb
+	}
+	return NewColor(v[0], v[1], v[2])
+}
+
+/* smooth spectrum through the channels of c, for quantities that aren't colors
+   (indices of refraction, absorption coefficients) */
+func (wl *Wavelengths) Interpolate(c *Color) *Color {
+	if wl == nil {
+		return NewColor(c.r, c.g, c.b)
+	}
+	return wl.basis(c.r, c.g, c.b)
+}
+
+/* reflectance spectrum of an RGB reflectance, bounded like it */
+func (wl *Wavelengths) Reflectance(c *Color) *Color {
+	if wl == nil {
+		return NewColor(c.r, c.g, c.b)
+	}
+	return wl.basis(math.Max(0, c.r), math.Max(0, c.g), math.Max(0, c.b))
+}
+
+/* emission spectrum of an RGB radiance, rendering back to the same RGB.
+   Saturated colors can ask for negative values, clamped to zero */
+func (wl *Wavelengths) Radiance(c *Color) *Color {
+	if wl == nil {
+		return NewColor(c.r, c.g, c.b)
+	}
+	m := &emissionToBasis
+	s := wl.basis(m[0][0]*c.r+m[0][1]*c.g+m[0][2]*c.b, m[1][0]*c.r+m[1][1]*c.g+m[1][2]*c.b, m[2][0]*c.r+m[2][1]*c.g+m[2][2]*c.b)
+	return NewColor(math.Max(0, s.r), math.Max(0, s.g), math.Max(0, s.b))
+}
+
+/* linear sRGB estimate of the spectrum known at the path wavelengths */
+func (wl *Wavelengths) ToRGB(c *Color) *Color {
+	if wl == nil {
+		return NewColor(c.r, c.g, c.b)
+	}
+	var x, y, z float64
+	/* uniform wavelengths : each of the three values is divided by its density 1/span */
+	scale := (LambdaMax - LambdaMin) / (3 * cieYIntegral)
+	for i, v := range [3]float64{c.r, c.g, c.b} {
+		x += v * CIEX(wl[i]) * scale
+		y += v * CIEY(wl[i]) * scale
+		z += v * CIEZ(wl[i]) * scale
+	}
+	return XYZToLinearSRGB(x, y, z)
+}
+
+/* wavelength in nanometers of the hero */
+func (wl *Wavelengths) Hero() float64 {
+	return wl[0]
+}
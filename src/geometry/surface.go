@@ -1,21 +1,49 @@
 package geometry
 
 import (
-	mrand "math/rand"
 	"math"
 )
 
 type SurfacePoint struct {
 	pTriangle *Triangle
 	pHitPosition *Point3
+	frame *Frame
+	uv UV
+	/* material of the triangle at the hit position */
+	bsdf Material
+	/* wavelengths of a spectral path, nil for RGB */
+	wl *Wavelengths
 }
 
 func NewSurfacePoint(pPos *Point3, pT *Triangle) *SurfacePoint {
-	return &SurfacePoint{pT, pPos}
+	uv := pT.UVAt(pPos)
+	return &SurfacePoint{pT, pPos, pT.shadingFrame(uv, pPos), uv, MaterialAt(pT.material, uv, pPos), nil}
+}
+
+/* the surface point seen by a spectral path : colors become values at its wavelengths */
+func (pSp *SurfacePoint) SetWavelengths(wl *Wavelengths) {
+	pSp.wl = wl
+	pSp.bsdf = MaterialAtWavelengths(pSp.bsdf, wl)
+}
+
+/* RGB albedo of the material at the hit position, white when the material can't tell */
+func (pSp *SurfacePoint) Albedo() *Color {
+	if m, ok := MaterialAt(pSp.pTriangle.material, pSp.uv, pSp.pHitPosition).(AlbedoMaterial); ok {
+		return m.Albedo()
+	}
+	return NewColor(1, 1, 1)
+}
+
+func (pSp *SurfacePoint) ShadingNormal() Vector3 {
+	return pSp.frame.n
+}
+
+func (pSp *SurfacePoint) UV() UV {
+	return pSp.uv
 }
 
 func (pSp *SurfacePoint) Object() *Triangle {
-	return pSp.pTriangle
+	return pSp.pTriangle.Origin()
 }
 
 func (pSp *SurfacePoint) HitPosition() *Point3 {
@@ -28,68 +56,71 @@ func (pSp *SurfacePoint) SurfacePointEmission(pToPos *Point3, pOutDir *Vector3,
 	distance2 := ray.DotProduct(*ray)
 	distance2 = math.Max(distance2, 1e-6)
 	normal := pSp.pTriangle.normal
-	cosout := pOutDir.DotProduct(normal)
+	cosout := math.Abs(pOutDir.DotProduct(normal))
 	cosArea := cosout * pSp.pTriangle.Area()
-	/* Emit from front face of surface only with infinity clamped out*/
+	/* Emit from the emitting faces of surface only with infinity clamped out*/
 	solidAngle = map[bool]float64{true:(cosArea/distance2),false:1.0}[isSolidAngle]
-	result := map[bool](*Color){true:MultC(&pSp.pTriangle.emit,solidAngle),false:NewColor(0,0,0)}[cosArea > 0.0]
-	return result
+	result := map[bool](*Color){true:MultC(pSp.pTriangle.EmitAt(pSp.uv, pSp.pHitPosition),solidAngle),false:NewColor(0,0,0)}[pSp.pTriangle.EmitsToward(pOutDir)]
+	return pSp.wl.Emission(result, pSp.pTriangle.spectral)
+}
+
+/* solid angle density of sampling the hit position uniformly on its triangle, seen from pFromPos */
+func (pSp *SurfacePoint) SurfacePointSolidAnglePdf(pFromPos *Point3) float64 {
+	ray := NewVectorFromPoints(*pSp.pHitPosition,*pFromPos)
+	distance2 := math.Max(ray.DotProduct(*ray), 1e-6)
+	cosArea := math.Abs(UnitizeV(*ray).DotProduct(pSp.pTriangle.normal)) * pSp.pTriangle.Area()
+	if cosArea <= 0.0 {
+		return 0.0
+	}
+	return distance2 / cosArea
 }
 
+/* solid angle density of SurfacePointNextDirection choosing pOutDirection,
+   0 for delta lobes */
+func (pSp *SurfacePoint) SurfacePointPdf(pInDirection *Vector3, pOutDirection *Vector3) float64 {
+	return pSp.bsdf.Pdf(pSp.frame.ToLocal(*pInDirection), pSp.frame.ToLocal(UnitizeV(*pOutDirection)))
+}
+
+/* a BSDF sample of the direction light comes from, pColor is its weight brdf * cos / pdf.
+   Ending the path is left to the caller, which knows its throughput */
 func (pSp *SurfacePoint) SurfacePointNextDirection(pInDirection *Vector3, pOutDirection **Vector3, pColor **Color) bool {
 	
-	reflectivityMean := (pSp.pTriangle.diffuse.r + pSp.pTriangle.diffuse.g + pSp.pTriangle.diffuse.b) / 3.0
-	
-	/* russian-roulette for reflectance 'magnitude' */
-	isAlive := mrand.Float64() < reflectivityMean
+	sample := pSp.bsdf.Sample(pSp.frame.ToLocal(*pInDirection))
 	
-	if isAlive {
-		/* cosine-weighted importance sample hemisphere */
-		twopr1 := math.Pi * 2.0 * mrand.Float64()
-		sr2 := math.Sqrt(mrand.Float64())
-		
-		/* make coord frame coefficients (z in normal direction) */
-		x := math.Cos(twopr1) * sr2
-		y := math.Sin(twopr1) * sr2
-		z := math.Sqrt(1.0 - (sr2 * sr2))
-		
-		/* make coord frame */
-		t := pSp.pTriangle.tangent
-		n := pSp.pTriangle.normal
-		
-		/* put normal on inward ray side of surface (preventing transmission) */
-		if n.DotProduct(*pInDirection) < 0.0 {
-			n = NegativeV(n)
-		}
-		
-		c := n.CrossProduct(t)
-		
-		/* scale frame by coefficients */
-		tx := MultV(t, x)
-		cy := MultV(c, y)
-		nz := MultV(n, z)
-		
-		/* make direction from sum of scaled components */
-		sum := AddV(&tx, &cy)
-		*pOutDirection = AddV(sum, &nz)
-		
-		/* make color by dividing-out mean from reflectivity */
-		*pColor = MultC(&pSp.pTriangle.diffuse, 1.0/ reflectivityMean) 
+	if sample.Pdf <= 0.0 || !sample.Weight.IsNotBlack() {
+		return false
 	}
 	
-	/* discluding degenerate result direction */
-	return isAlive && (!IsNillVector(**pOutDirection))
+	/* back from the shading frame */
+	direction := pSp.frame.ToWorld(sample.Direction)
+	*pOutDirection = &direction
+	*pColor = &sample.Weight
+	
+	/* discluding degenerate result direction, and directions the shading normal sends
+	   to the wrong side of the geometry */
+	return !IsNillVector(**pOutDirection) && pSp.consistent(pInDirection, *pOutDirection)
 }
 
+/* radiance pInRadiance arriving from pInDirection, scattered toward pOutDirection */
 func (pSp *SurfacePoint) SurfacePointReflection(pInDirection *Vector3, pInRadiance *Color, pOutDirection *Vector3) *Color {
-	inDot := pInDirection.DotProduct(pSp.pTriangle.normal)
-	outDot := pOutDirection.DotProduct(pSp.pTriangle.normal)
-	
-	/* directions must be on same side of surface (no transmission) */
-	isSameSide := !(((inDot < 0.0) || (outDot < 0.0)) && (!((inDot < 0.0) && (outDot < 0.0))))
-	
-	/* ideal diffuse BRDF:
-      radiance scaled by reflectivity, cosine, and 1/pi  */
-	r := ColorMultC(pInRadiance, &pSp.pTriangle.diffuse)
-	return MultC(r, (math.Abs(inDot)/math.Pi)*(map[bool](float64){true:1.0,false:0.0}[isSameSide]))
-}
\ No newline at end of file
+	if !pSp.consistent(pOutDirection, pInDirection) {
+		return NewColor(0, 0, 0)
+	}
+	wi := pSp.frame.ToLocal(*pInDirection)
+	wo := pSp.frame.ToLocal(*pOutDirection)
+	f := pSp.bsdf.Eval(wo, wi)
+	return MultC(ColorMultC(pInRadiance, f), math.Abs(wi.z))
+}
+
+/* a perturbed shading normal can see reflection where the triangle sees transmission
+   (or the reverse) : such pairs of directions are refused, light doesn't leak through */
+func (pSp *SurfacePoint) consistent(pDir0 *Vector3, pDir1 *Vector3) bool {
+	if pSp.pTriangle.normalMap == nil && pSp.pTriangle.bumpMap == nil {
+		return true
+	}
+	ng := pSp.pTriangle.normal
+	ns := pSp.frame.n
+	geometric := pDir0.DotProduct(ng)*pDir1.DotProduct(ng) > 0
+	shading := pDir0.DotProduct(ns)*pDir1.DotProduct(ns) > 0
+	return geometric == shading
+}
@@ -0,0 +1,177 @@
+package geometry
+
+import (
+	"image"
+	"math"
+)
+
+/* surface coordinates of a point of a triangle, interpolated from its vertices */
+type UV struct {
+	u, v float64
+}
+
+func NewUV(u float64, v float64) *UV {
+	return &UV{u, v}
+}
+
+func (uv UV) U() float64 {
+	return uv.u
+}
+
+func (uv UV) V() float64 {
+	return uv.v
+}
+
+/* color varying over a surface, looked up by surface coordinates or by position */
+type Texture interface {
+	Evaluate(uv UV, p *Point3) *Color
+	/* mean value, stands for the texture where a single color is needed (emitted power) */
+	Average() *Color
+}
+
+type ConstantTexture struct {
+	value Color
+}
+
+func NewConstantTexture(c *Color) *ConstantTexture {
+	return &ConstantTexture{*c}
+}
+
+func (t *ConstantTexture) Evaluate(uv UV, p *Point3) *Color {
+	return NewColor(t.value.r, t.value.g, t.value.b)
+}
+
+func (t *ConstantTexture) Average() *Color {
+	return NewColor(t.value.r, t.value.g, t.value.b)
+}
+
+const (
+	WrapRepeat = iota
+	WrapClamp
+	WrapMirror
+)
+
+/* bitmap texture, bilinearly filtered, the v axis going up from the bottom of the image */
+type ImageTexture struct {
+	width, height int
+	texels []Color
+	wrap int
+	average Color
+}
+
+/* texels are decoded from sRGB to linear values when srgb is set */
+func NewImageTexture(img image.Image, wrap int, srgb bool) *ImageTexture {
+	bounds := img.Bounds()
+	t := &ImageTexture{width: bounds.Dx(), height: bounds.Dy(), wrap: wrap}
+	t.texels = make([]Color, t.width*t.height)
+	sum := NewColor(0, 0, 0)
+	for y := 0; y < t.height; y++ {
+		for x := 0; x < t.width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			c := Color{float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff}
+			if srgb {
+				c = Color{SRGBToLinear(c.r), SRGBToLinear(c.g), SRGBToLinear(c.b)}
+			}
+			t.texels[x+t.width*y] = c
+			sum = AddColor(*sum, c)
+		}
+	}
+	t.average = *MultC(sum, 1/float64(len(t.texels)))
+	return t
+}
+
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func (t *ImageTexture) wrapIndex(i int, size int) int {
+	switch t.wrap {
+	case WrapClamp:
+		return int(math.Max(0, math.Min(float64(size-1), float64(i))))
+	case WrapMirror:
+		period := 2 * size
+		i = ((i % period) + period) % period
+		if i >= size {
+			i = period - 1 - i
+		}
+		return i
+	}
+	return ((i % size) + size) % size
+}
+
+func (t *ImageTexture) texel(x int, y int) *Color {
+	return &t.texels[t.wrapIndex(x, t.width)+t.width*t.wrapIndex(y, t.height)]
+}
+
+func (t *ImageTexture) Evaluate(uv UV, p *Point3) *Color {
+	/* texel centers at half integers, image rows top down */
+	x := uv.u*float64(t.width) - 0.5
+	y := (1-uv.v)*float64(t.height) - 0.5
+	x0 := math.Floor(x)
+	y0 := math.Floor(y)
+	dx := x - x0
+	dy := y - y0
+	ix := int(x0)
+	iy := int(y0)
+	top := AddColor(*MultC(t.texel(ix, iy), 1-dx), *MultC(t.texel(ix+1, iy), dx))
+	bottom := AddColor(*MultC(t.texel(ix, iy+1), 1-dx), *MultC(t.texel(ix+1, iy+1), dx))
+	return AddColor(*MultC(top, 1-dy), *MultC(bottom, dy))
+}
+
+func (t *ImageTexture) Average() *Color {
+	return NewColor(t.average.r, t.average.g, t.average.b)
+}
+
+/* two colors alternating over a grid of scale squares per unit of uv */
+type CheckerTexture struct {
+	even, odd Color
+	scale float64
+}
+
+func NewCheckerTexture(even *Color, odd *Color, scale float64) *CheckerTexture {
+	return &CheckerTexture{*even, *odd, scale}
+}
+
+func (t *CheckerTexture) Evaluate(uv UV, p *Point3) *Color {
+	if (int(math.Floor(uv.u*t.scale))+int(math.Floor(uv.v*t.scale)))%2 == 0 {
+		return NewColor(t.even.r, t.even.g, t.even.b)
+	}
+	return NewColor(t.odd.r, t.odd.g, t.odd.b)
+}
+
+func (t *CheckerTexture) Average() *Color {
+	return MultC(AddColor(t.even, t.odd), 0.5)
+}
+
+/* solid texture : fractal Perlin noise of the position blends the two colors */
+type NoiseTexture struct {
+	low, high Color
+	scale float64
+	octaves int
+}
+
+func NewNoiseTexture(low *Color, high *Color, scale float64, octaves int) *NoiseTexture {
+	return &NoiseTexture{*low, *high, scale, int(math.Max(1, float64(octaves)))}
+}
+
+func (t *NoiseTexture) Evaluate(uv UV, p *Point3) *Color {
+	sum := 0.0
+	amplitude := 1.0
+	frequency := t.scale
+	norm := 0.0
+	for i := 0; i < t.octaves; i++ {
+		sum += amplitude * perlin(p.x*frequency, p.y*frequency, p.z*frequency)
+		norm += amplitude
+		amplitude *= 0.5
+		frequency *= 2
+	}
+	blend := math.Max(0, math.Min(1, 0.5+0.5*sum/norm))
+	return AddColor(*MultC(&t.low, 1-blend), *MultC(&t.high, blend))
+}
+
+func (t *NoiseTexture) Average() *Color {
+	return MultC(AddColor(t.low, t.high), 0.5)
+}
@@ -0,0 +1,51 @@
+package geometry
+
+import (
+	"math"
+)
+
+/* affine transform p -> m p + offset */
+type Transform struct {
+	m [3][3]float64
+	offset Vector3
+}
+
+func IdentityTransform() *Transform {
+	return &Transform{[3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, Vector3{}}
+}
+
+/* scales uniformly and rotates around pivot, by the angles in degrees around x, then y, then z,
+   then translates */
+func NewTransform(translation Vector3, rotation Vector3, scale float64, pivot Point3) *Transform {
+	rx, ry, rz := rotation.x*math.Pi/180, rotation.y*math.Pi/180, rotation.z*math.Pi/180
+	x := [3][3]float64{{1, 0, 0}, {0, math.Cos(rx), -math.Sin(rx)}, {0, math.Sin(rx), math.Cos(rx)}}
+	y := [3][3]float64{{math.Cos(ry), 0, math.Sin(ry)}, {0, 1, 0}, {-math.Sin(ry), 0, math.Cos(ry)}}
+	z := [3][3]float64{{math.Cos(rz), -math.Sin(rz), 0}, {math.Sin(rz), math.Cos(rz), 0}, {0, 0, 1}}
+	m := mul3(z, mul3(y, x))
+	for i := range m {
+		for j := range m[i] {
+			m[i][j] *= scale
+		}
+	}
+	t := &Transform{m, Vector3{}}
+	moved := t.apply(pivot)
+	t.offset = Vector3{pivot.x - moved.x + translation.x, pivot.y - moved.y + translation.y, pivot.z - moved.z + translation.z}
+	return t
+}
+
+func (t *Transform) apply(p Point3) Point3 {
+	return Point3{t.m[0][0]*p.x + t.m[0][1]*p.y + t.m[0][2]*p.z,
+		t.m[1][0]*p.x + t.m[1][1]*p.y + t.m[1][2]*p.z,
+		t.m[2][0]*p.x + t.m[2][1]*p.y + t.m[2][2]*p.z}
+}
+
+func (t *Transform) Point(p Point3) Point3 {
+	q := t.apply(p)
+	return Point3{q.x + t.offset.x, q.y + t.offset.y, q.z + t.offset.z}
+}
+
+/* direction transformed, without the translation */
+func (t *Transform) Vector(v Vector3) Vector3 {
+	p := t.apply(Point3{v.x, v.y, v.z})
+	return Vector3{p.x, p.y, p.z}
+}
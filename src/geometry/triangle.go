@@ -8,36 +8,228 @@ import (
 type Triangle struct {
 	id string
 	p0, p1, p2 Point3
-	emit, diffuse Color
+	emit Color
+	/* emission varying over the surface, nil for the constant emit */
+	emitTexture Texture
+	/* spectrum of the emission, nil for an RGB emitter */
+	spectral *SpectralEmission
+	/* faces emitting light, EmitFront unless set */
+	emitSides int
+	/* surface coordinates of the vertices */
+	uv0, uv1, uv2 UV
+	/* shading normal perturbations, see bump.go */
+	normalMap, bumpMap Texture
+	bumpScale float64
+	material Material
+	/* medium enclosed by the closed mesh the triangle belongs to, normals pointing outside */
+	interior *Medium
 	bbox BoundingBox
 	edge0, edge1, edge2 Vector3
 	tangent, normal Vector3
+	/* derivatives of the position along the surface coordinates */
+	dpdu, dpdv Vector3
+	area float64
+	/* vertices at the closing of the shutter, nil for a triangle standing still. In between
+	   they move linearly with the time of the ray, the bounds hold the whole motion */
+	end *[3]Point3
+	/* moving triangle an instant of it was taken from */
+	origin *Triangle
 }
 
-func NewTriangle(id string, p0 *Point3, p1 *Point3, p2 *Point3, emit *Color, diffuse *Color) *Triangle {
+func NewTriangle(id string, p0 *Point3, p1 *Point3, p2 *Point3, emit *Color, material Material) *Triangle {
 	t := &Triangle{}
 	t.p0 = *p0
 	t.p1 = *p1
 	t.p2 = *p2
 	t.emit = *emit
-	t.diffuse = *diffuse
+	t.material = material
 	t.id = id
+	t.uv0 = UV{0, 0}
+	t.uv1 = UV{1, 0}
+	t.uv2 = UV{0, 1}
 	t.init()
 	return t
 }
 
 func (t *Triangle) init() {
 	t.bbox = *NewBBoxFromTriangle(*t)
+	if t.end != nil {
+		end := Triangle{p0: t.end[0], p1: t.end[1], p2: t.end[2]}
+		t.bbox = *ExpandBBox(&t.bbox, NewBBoxFromTriangle(end)).(*BoundingBox)
+	}
 	t.edge0 = *NewVectorFromPoints(t.p0, t.p1)
 	t.edge1 = *NewVectorFromPoints(t.p1, t.p2)
 	t.edge2 = *NewVectorFromPoints(t.p0, t.p2)
 	t.tangent = UnitizeV(t.edge0)
-	t.normal = t.edge0.CrossProduct(t.edge1)
+	pa2 := t.edge0.CrossProduct(t.edge1)
+	t.area = pa2.length() * 0.5
+	t.normal = UnitizeV(pa2)
+	t.differentials()
+}
+
+/* solves edge0 = du0 dpdu + dv0 dpdv, edge2 = du2 dpdu + dv2 dpdv,
+   falling back on the edges when the surface coordinates are degenerate */
+func (t *Triangle) differentials() {
+	du0, dv0 := t.uv1.u-t.uv0.u, t.uv1.v-t.uv0.v
+	du2, dv2 := t.uv2.u-t.uv0.u, t.uv2.v-t.uv0.v
+	det := du0*dv2 - dv0*du2
+	if math.Abs(det) < 1e-12 {
+		t.dpdu = t.edge0
+		t.dpdv = t.edge2
+		return
+	}
+	t.dpdu = MultV(t.edge0, dv2/det).AddV(MultV(t.edge2, -dv0/det))
+	t.dpdv = MultV(t.edge2, du0/det).AddV(MultV(t.edge0, -du2/det))
+}
+
+func (t *Triangle) Vertices() [3]Point3 {
+	return [3]Point3{t.p0, t.p1, t.p2}
+}
+
+/* moves the triangle, the surface coordinates and everything else about it stay */
+func (t *Triangle) SetVertices(p0 Point3, p1 Point3, p2 Point3) {
+	t.p0, t.p1, t.p2 = p0, p1, p2
+	t.init()
+}
+
+/* vertices at the closing of the shutter, the current ones being those at its opening.
+   nil stops the triangle */
+func (t *Triangle) SetMotion(end *[3]Point3) {
+	if end != nil {
+		e := *end
+		end = &e
+	}
+	t.end = end
+	t.init()
+}
+
+/* the triangle where it is at that time of the shutter interval, itself when it doesn't move */
+func (t *Triangle) At(time float64) *Triangle {
+	if t.end == nil || time == 0 {
+		return t
+	}
+	lerp := func(a Point3, b Point3) Point3 {
+		return Point3{a.x + time*(b.x-a.x), a.y + time*(b.y-a.y), a.z + time*(b.z-a.z)}
+	}
+	instant := *t
+	instant.p0, instant.p1, instant.p2 = lerp(t.p0, t.end[0]), lerp(t.p1, t.end[1]), lerp(t.p2, t.end[2])
+	instant.end = nil
+	instant.origin = t
+	instant.init()
+	return &instant
+}
+
+/* the triangle of the scene an instant of a moving triangle stands for, itself otherwise */
+func (t *Triangle) Origin() *Triangle {
+	if t.origin != nil {
+		return t.origin
+	}
+	return t
 }
 
 func (t *Triangle) Area() float64 {
-	pa2 := t.normal
-	return math.Sqrt(pa2.DotProduct(pa2)) * 0.5
+	return t.area
+}
+
+func (t *Triangle) Emit() Color {
+	return t.emit
+}
+
+const (
+	EmitFront = iota
+	EmitBack
+	EmitBoth
+)
+
+func (t *Triangle) SetEmitSides(sides int) {
+	t.emitSides = sides
+}
+
+func (t *Triangle) EmitSides() int {
+	return t.emitSides
+}
+
+/* whether light leaves the triangle toward the direction dir */
+func (t *Triangle) EmitsToward(dir *Vector3) bool {
+	cos := dir.DotProduct(t.normal)
+	switch t.emitSides {
+	case EmitBack:
+		return cos < 0
+	case EmitBoth:
+		return cos != 0
+	}
+	return cos > 0
+}
+
+/* emit is set to the RGB value of the spectrum */
+func (t *Triangle) SetSpectralEmission(e *SpectralEmission) {
+	t.spectral = e
+	t.emit = *e.RGB()
+	t.emitTexture = nil
+}
+
+func (t *Triangle) SpectralEmission() *SpectralEmission {
+	return t.spectral
+}
+
+/* emit is set to the texture average, which lights are chosen by */
+func (t *Triangle) SetEmitTexture(texture Texture) {
+	t.emitTexture = texture
+	t.emit = *texture.Average()
+	t.spectral = nil
+}
+
+/* emitted radiance at the point p of surface coordinates uv */
+func (t *Triangle) EmitAt(uv UV, p *Point3) *Color {
+	if t.emitTexture == nil {
+		return NewColor(t.emit.r, t.emit.g, t.emit.b)
+	}
+	return t.emitTexture.Evaluate(uv, p)
+}
+
+func (t *Triangle) SetUV(uv0 *UV, uv1 *UV, uv2 *UV) {
+	t.uv0 = *uv0
+	t.uv1 = *uv1
+	t.uv2 = *uv2
+	t.differentials()
+}
+
+/* surface coordinates of the point p of the triangle, interpolated with its barycentric coordinates */
+func (t *Triangle) UVAt(p *Point3) UV {
+	v := *NewVectorFromPoints(t.p0, *p)
+	d00 := t.edge0.DotProduct(t.edge0)
+	d01 := t.edge0.DotProduct(t.edge2)
+	d11 := t.edge2.DotProduct(t.edge2)
+	d20 := v.DotProduct(t.edge0)
+	d21 := v.DotProduct(t.edge2)
+	denom := d00*d11 - d01*d01
+	if denom == 0 {
+		return t.uv0
+	}
+	b1 := (d11*d20 - d01*d21) / denom
+	b2 := (d00*d21 - d01*d20) / denom
+	b0 := 1 - b1 - b2
+	return UV{b0*t.uv0.u + b1*t.uv1.u + b2*t.uv2.u, b0*t.uv0.v + b1*t.uv1.v + b2*t.uv2.v}
+}
+
+func (t *Triangle) Material() Material {
+	return t.material
+}
+
+func (t *Triangle) Id() string {
+	return t.id
+}
+
+func (t *Triangle) Interior() *Medium {
+	return t.interior
+}
+
+func (t *Triangle) SetInterior(m *Medium) {
+	t.interior = m
+}
+
+func (t *Triangle) Normal() Vector3 {
+	return t.normal
 }
 func IsLight(t *Triangle) bool {
 	return t.emit.IsNotBlack()
@@ -48,6 +240,13 @@ func (t *Triangle) Box() BoundingBox {
 }
 
 func (t *Triangle) intersectedByRay(ray *Ray) []Intersectable {
+	if t.end != nil && ray.time != 0 {
+		hits := t.At(ray.time).intersectedByRay(&Ray{ray.origin, ray.direction, 0})
+		if hit, ok := hits[0].(*IntersectDist); ok {
+			hit.triangle = t
+		}
+		return hits
+	}
 	temp := make([]Intersectable, 1)
 	p := ray.direction.CrossProduct(t.edge2)
 	det := p.DotProduct(t.edge0)
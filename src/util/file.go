@@ -1,10 +1,15 @@
 package util
 
 import (
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"os"
 	"bytes"
 	"io"
 	"strings"
+	"strconv"
+	"geometry"
 )
 
 func Parse(s string) ( result string) {
@@ -47,4 +52,45 @@ func getContent(file *os.File) (finalContent string) {
 	finalContent = strings.Join(tempContent,"\n")
 	
 	return
-}
\ No newline at end of file
+}
+/* PNG or JPEG image, nil when the file can't be read */
+func LoadImage(s string) image.Image {
+	f, err := os.Open(s)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+/* spectral power distribution file : one "wavelength value" pair per line, wavelengths
+   in nanometers, # comments. nil when the file can't be read or holds no sample */
+func LoadSpectrum(s string) *geometry.TabulatedSpectrum {
+	f, err := os.Open(s)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lambdas, values []float64
+	for _,line := range strings.Split(getContent(f),"\n") {
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' || r == '\r' })
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		lambda, err0 := strconv.ParseFloat(fields[0],64)
+		value, err1 := strconv.ParseFloat(fields[1],64)
+		if err0 != nil || err1 != nil {
+			continue
+		}
+		lambdas = append(lambdas, lambda)
+		values = append(values, value)
+	}
+	if len(lambdas) == 0 {
+		return nil
+	}
+	return geometry.NewTabulatedSpectrum(lambdas, values)
+}
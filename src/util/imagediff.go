@@ -0,0 +1,66 @@
+package util
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+/* differences between two images of the same size, on 8 bit channels (0 to 255) */
+type ImageDiff struct {
+	/* root mean square of the channel differences, and the matching peak signal to noise
+	   ratio in decibels, +Inf for identical images */
+	RMSE, PSNR float64
+	/* largest channel difference */
+	Max float64
+	/* pixels with a channel differing by more than the tolerance */
+	Differing, Pixels int
+	/* per pixel largest channel difference, black to red to white */
+	Heatmap *image.RGBA
+}
+
+/* compares a and b channel by channel (red, green and blue), a pixel differs when one of
+   its channels is off by more than tolerance */
+func CompareImages(a image.Image, b image.Image, tolerance float64) (*ImageDiff, error) {
+	ra, rb := a.Bounds(), b.Bounds()
+	if ra.Dx() != rb.Dx() || ra.Dy() != rb.Dy() {
+		return nil, fmt.Errorf("sizes differ : %dx%d and %dx%d", ra.Dx(), ra.Dy(), rb.Dx(), rb.Dy())
+	}
+	d := &ImageDiff{Pixels: ra.Dx() * ra.Dy(), Heatmap: image.NewRGBA(image.Rect(0, 0, ra.Dx(), ra.Dy()))}
+	sum := 0.0
+	for y := 0; y < ra.Dy(); y++ {
+		for x := 0; x < ra.Dx(); x++ {
+			ca := color.NRGBAModel.Convert(a.At(ra.Min.X+x, ra.Min.Y+y)).(color.NRGBA)
+			cb := color.NRGBAModel.Convert(b.At(rb.Min.X+x, rb.Min.Y+y)).(color.NRGBA)
+			worst := 0.0
+			for _,c := range [][2]uint8{{ca.R, cb.R}, {ca.G, cb.G}, {ca.B, cb.B}} {
+				delta := math.Abs(float64(c[0]) - float64(c[1]))
+				sum += delta * delta
+				worst = math.Max(worst, delta)
+			}
+			d.Max = math.Max(d.Max, worst)
+			if worst > tolerance {
+				d.Differing++
+			}
+			d.Heatmap.Set(x, y, heat(worst/255))
+		}
+	}
+	if d.Pixels > 0 {
+		d.RMSE = math.Sqrt(sum / float64(3*d.Pixels))
+	}
+	d.PSNR = math.Inf(1)
+	if d.RMSE > 0 {
+		d.PSNR = 20 * math.Log10(255/d.RMSE)
+	}
+	return d, nil
+}
+
+/* [0,1] to black, red, yellow then white, small differences stand out */
+func heat(v float64) color.RGBA {
+	v = math.Sqrt(math.Max(0, math.Min(1, v)))
+	channel := func(t float64) uint8 {
+		return uint8(255 * math.Max(0, math.Min(1, t)))
+	}
+	return color.RGBA{channel(3 * v), channel(3*v - 1), channel(3*v - 2), 255}
+}
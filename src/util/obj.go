@@ -0,0 +1,269 @@
+package util
+
+import (
+	"bufio"
+	"core"
+	"errors"
+	"fmt"
+	"geometry"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/* reflectivity of the triangles whose OBJ material gives no diffuse color */
+const objDefaultReflectivity float64 = 0.7
+
+/* the triangles of the scene as a Wavefront OBJ file, one group per triangle name, and their
+   diffuse and emitted colors in a material library beside it (same name, .mtl extension).
+   warnings tell what the OBJ file can't hold : cameras, lights other than the emitting
+   triangles, materials other than a plain diffuse color, spectral emission */
+func WriteOBJ(scene *core.Scene, path string) (warnings []string, err error) {
+	library := strings.TrimSuffix(path, filepath.Ext(path)) + ".mtl"
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	/* a full disk can show up on close only */
+	defer closeChecked(f, &err)
+	m, err := os.Create(library)
+	if err != nil {
+		return nil, err
+	}
+	defer closeChecked(m, &err)
+	
+	info := scene.Info()
+	if info.Views > 0 {
+		warnings = append(warnings, fmt.Sprintf("the camera and %d named views are dropped", info.Views))
+	} else {
+		warnings = append(warnings, "the camera is dropped")
+	}
+	if info.Lights > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d point, spot or directional lights are dropped", info.Lights))
+	}
+	/* one warning per triangle name and loss */
+	lost := make(map[string]bool)
+	lose := func(warning string) {
+		if !lost[warning] {
+			lost[warning] = true
+			warnings = append(warnings, warning)
+		}
+	}
+	prims := scene.Primitives()
+
+	out := bufio.NewWriter(f)
+	mtl := bufio.NewWriter(m)
+	fmt.Fprintf(out, "# %d triangles\nmtllib %s\n", len(prims), filepath.Base(library))
+
+	/* a material per distinct pair of colors */
+	materials := make(map[[6]float64]string)
+	group := ""
+	vertex := 0
+	for _,t := range prims {
+		if t == nil {
+			continue
+		}
+		albedo := geometry.NewColor(0, 0, 0)
+		kind := strings.TrimSuffix(strings.ToLower(strings.TrimPrefix(fmt.Sprintf("%T", t.Material()), "*geometry.")), "material")
+		if a, ok := t.Material().(geometry.AlbedoMaterial); ok {
+			albedo = a.Albedo()
+		}
+		switch m := t.Material().(type) {
+		case *geometry.Lambertian:
+			if m.Textured() {
+				lose(fmt.Sprintf("triangle %s : textured material written as the diffuse color of its average", t.Id()))
+			}
+		case geometry.AlbedoMaterial:
+			lose(fmt.Sprintf("triangle %s : %s material written as a diffuse color, its albedo", t.Id(), kind))
+		default:
+			lose(fmt.Sprintf("triangle %s : %s material written as Kd 0 0 0", t.Id(), kind))
+		}
+		if t.SpectralEmission() != nil {
+			lose(fmt.Sprintf("triangle %s : spectral emission written as its RGB emission", t.Id()))
+		}
+		emit := t.Emit()
+		kr, kg, kb := albedo.RGB()
+		er, eg, eb := emit.RGB()
+		key := [6]float64{kr, kg, kb, er, eg, eb}
+		name, ok := materials[key]
+		if !ok {
+			name = fmt.Sprintf("material%d", len(materials))
+			materials[key] = name
+			fmt.Fprintf(mtl, "newmtl %s\nKd %g %g %g\nKe %g %g %g\n\n", name, kr, kg, kb, er, eg, eb)
+		}
+		if t.Id() != group {
+			group = t.Id()
+			fmt.Fprintf(out, "g %s\n", group)
+		}
+		fmt.Fprintf(out, "usemtl %s\n", name)
+		for _,v := range t.Vertices() {
+			fmt.Fprintf(out, "v %g %g %g\n", v.X(), v.Y(), v.Z())
+		}
+		fmt.Fprintf(out, "f %d %d %d\n", vertex+1, vertex+2, vertex+3)
+		vertex += 3
+	}
+	if err := mtl.Flush(); err != nil {
+		return nil, err
+	}
+	return warnings, out.Flush()
+}
+
+/* closes f, its error goes to *err unless there already is one */
+func closeChecked(f *os.File, err *error) {
+	if cerr := f.Close(); *err == nil {
+		*err = cerr
+	}
+}
+
+type objMaterial struct {
+	diffuse, emission [3]float64
+}
+
+/* a scene file made of the faces of a Wavefront OBJ file : polygons are split in fans,
+   triangles are named after their group (letters only), colored by the Kd and Ke of their
+   material. The camera looks at the model along z from far enough to frame it */
+func OBJToScene(path string, iterations int, width int, height int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var vertices []geometry.Point3
+	materials := make(map[string]objMaterial)
+	current := objMaterial{[3]float64{objDefaultReflectivity, objDefaultReflectivity, objDefaultReflectivity}, [3]float64{}}
+	group := "Object"
+	var lines []string
+	min := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return "", fmt.Errorf("%s:%d: vertex with less than 3 coordinates", path, n)
+			}
+			var c [3]float64
+			for i := range c {
+				if c[i], err = strconv.ParseFloat(fields[i+1], 64); err != nil {
+					return "", fmt.Errorf("%s:%d: %v", path, n, err)
+				}
+				min[i] = math.Min(min[i], c[i])
+				max[i] = math.Max(max[i], c[i])
+			}
+			vertices = append(vertices, *geometry.NewPoint(c[0], c[1], c[2]))
+		case "g", "o":
+			if len(fields) > 1 {
+				group = objName(fields[1])
+			}
+		case "mtllib":
+			if len(fields) > 1 {
+				readMTL(filepath.Join(filepath.Dir(path), fields[1]), materials)
+			}
+		case "usemtl":
+			if m, ok := materials[strings.Join(fields[1:], " ")]; ok {
+				current = m
+			}
+		case "f":
+			var face []geometry.Point3
+			for _,field := range fields[1:] {
+				i, err := strconv.Atoi(strings.Split(field, "/")[0])
+				/* negative indices count back from the last vertex */
+				if err == nil && i < 0 {
+					i += len(vertices) + 1
+				}
+				if err != nil || i < 1 || i > len(vertices) {
+					return "", fmt.Errorf("%s:%d: invalid vertex index %s", path, n, field)
+				}
+				face = append(face, vertices[i-1])
+			}
+			for i := 2; i < len(face); i++ {
+				lines = append(lines, objTriangle(group, face[0], face[i-1], face[i], current))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "", errors.New(path + " has no face")
+	}
+
+	/* the camera stands back along -z so that the larger side of the model fills its 45 degrees */
+	const fov = 45
+	center := [3]float64{(min[0] + max[0]) / 2, (min[1] + max[1]) / 2, (min[2] + max[2]) / 2}
+	size := math.Max(max[0]-min[0], max[1]-min[1])
+	distance := size/2/math.Tan(fov/2*math.Pi/180) + (max[2]-min[2])/2
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#MiniLight\n\n%d\n\n%d %d\n\n", iterations, width, height)
+	fmt.Fprintf(&b, "(%.6f %.6f %.6f) (0 0 1) %d\n\n", center[0], center[1], center[2]-distance*1.1, fov)
+	b.WriteString("(0.500000 0.500000 0.500000) (0.100000 0.090000 0.070000)\n\n")
+	for _,l := range lines {
+		b.WriteString(l)
+	}
+	return b.String(), nil
+}
+
+/* Kd and Ke of the materials of an OBJ material library, the file is optional */
+func readMTL(path string, materials map[string]objMaterial) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var name string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "newmtl" {
+			name = strings.Join(fields[1:], " ")
+			materials[name] = objMaterial{[3]float64{objDefaultReflectivity, objDefaultReflectivity, objDefaultReflectivity}, [3]float64{}}
+			continue
+		}
+		if (fields[0] != "Kd" && fields[0] != "Ke") || len(fields) < 4 {
+			continue
+		}
+		var c [3]float64
+		for i := range c {
+			c[i], _ = strconv.ParseFloat(fields[i+1], 64)
+		}
+		m := materials[name]
+		if fields[0] == "Kd" {
+			m.diffuse = c
+		} else {
+			m.emission = c
+		}
+		materials[name] = m
+	}
+}
+
+/* the letters of an OBJ name, the only characters of a triangle name */
+func objName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return -1
+	}, s)
+	if name == "" {
+		return "Object"
+	}
+	return name
+}
+
+func objTriangle(name string, p0 geometry.Point3, p1 geometry.Point3, p2 geometry.Point3, m objMaterial) string {
+	return fmt.Sprintf("%s (%.6f %.6f %.6f) (%.6f %.6f %.6f) (%.6f %.6f %.6f)  (%.6f %.6f %.6f) (%.6f %.6f %.6f)\n", name,
+		p0.X(), p0.Y(), p0.Z(), p1.X(), p1.Y(), p1.Z(), p2.X(), p2.Y(), p2.Z(),
+		m.diffuse[0], m.diffuse[1], m.diffuse[2], m.emission[0], m.emission[1], m.emission[2])
+}
@@ -1,27 +1,67 @@
 package util
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"regexp"
+	"strings"
 	"strconv"
 	"core"
 	"geometry"
 	"accelerators"
-//	"fmt"
 )
 
-func ParseFile(s string) *core.Scene {
-	sceneOpts := ParseSceneOpts(s)
-	camera := ParseCamera(s)
-	world := ParseWorld(s)
-	primitives := ParsePrimitives(s)
+/* the scene of the file content s, an error when a line every scene needs is missing */
+func ParseFile(s string) (*core.Scene, error) {
+	sceneOpts, err := ParseSceneOpts(s)
+	if err != nil {
+		return nil, err
+	}
+	camera, err := ParseCamera(s)
+	if err != nil {
+		return nil, err
+	}
+	world, err := ParseWorld(s)
+	if err != nil {
+		return nil, err
+	}
+	textures, err := ParseTextures(s)
+	if err != nil {
+		return nil, err
+	}
+	primitives, err := ParsePrimitives(s, ParseMaterials(s, textures))
+	if err != nil {
+		return nil, err
+	}
+	if err := ParseTextureCoordinates(s, primitives, textures); err != nil {
+		return nil, err
+	}
+	if err := ParseShadingNormals(s, primitives, textures); err != nil {
+		return nil, err
+	}
+	spectra, err := ParseSpectra(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := ParseSpectralEmitters(s, primitives, spectra); err != nil {
+		return nil, err
+	}
+	if len(primitives) == 0 {
+		return nil, errors.New("no triangle")
+	}
 	lights := geometry.MapBool(geometry.IsLight,primitives)
+	animation := ParseAnimation(s, primitives)
 	
 	var tree accelerators.Tree
 	
 	tree = &accelerators.EmptyTree{}
 	
+	/* animated triangles are kept out of the tree shared by the frames */
 	for _,v := range primitives {
-		tree = accelerators.Insert(tree, v)
+		if animation == nil || !animation.IsAnimated(v) {
+			tree = accelerators.Insert(tree, v)
+		}
 	}
 	
 	
@@ -33,10 +73,36 @@ func ParseFile(s string) *core.Scene {
 		enveloppe = geometry.ExpandBBox(enveloppe,&bbox)
 	}
 	
-	return core.NewScene(sceneOpts,camera,world,primitives,lights,tree,enveloppe.(*geometry.BoundingBox))
+	scene := core.NewScene(sceneOpts,camera,world,primitives,lights,tree,enveloppe.(*geometry.BoundingBox))
+	
+	for _,l := range ParseLights(s) {
+		scene.AddLight(l)
+	}
+	
+	spectralLights, err := ParseSpectralLights(s, spectra)
+	if err != nil {
+		return nil, err
+	}
+	for _,l := range spectralLights {
+		scene.AddLight(l)
+	}
+	
+	if err := ParseMedia(s, scene, primitives); err != nil {
+		return nil, err
+	}
+	
+	if animation != nil {
+		scene.SetAnimation(animation)
+	}
+	
+	if err := ParseViews(s, scene, camera); err != nil {
+		return nil, err
+	}
+	
+	return scene, nil
 }
 
-func ParseSceneOpts(s string) (opts *core.SceneOpts) {
+func ParseSceneOpts(s string) (opts *core.SceneOpts, err error) {
 	itRE := regexp.MustCompile(`(?m)^([0-9]+)$`)
 	index := itRE.FindStringSubmatch(s)
 	
@@ -44,6 +110,8 @@ func ParseSceneOpts(s string) (opts *core.SceneOpts) {
 	
 	if len(index) > 1 {
 		iterations,_ = strconv.ParseInt(index[1],10,0)
+	} else {
+		return nil, errors.New("no iterations line : samples per pixel")
 	}
 	
 	frSizeRE := regexp.MustCompile(`(?m)^([0-9]+) ([0-9]+)$`)
@@ -54,13 +122,26 @@ func ParseSceneOpts(s string) (opts *core.SceneOpts) {
 		width,_ = strconv.ParseInt(index[1],10,0)
 		height,_ = strconv.ParseInt(index[2],10,0)
 	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("no image size line : width height")
+	}
 	
 	opts = core.NewOpts(iterations, width, height)
 	
+	adaptiveRE := regexp.MustCompile(`(?m)^adaptive ([0-9]+\.?[0-9]*)(?: ([0-9]+))?(?: ([0-9]+))?$`)
+	index = adaptiveRE.FindStringSubmatch(s)
+	
+	if len(index) > 1 {
+		threshold,_ := strconv.ParseFloat(index[1],64)
+		budget,_ := strconv.ParseInt(index[2],10,0)
+		tileSize,_ := strconv.ParseInt(index[3],10,0)
+		opts.SetAdaptive(threshold, budget, tileSize)
+	}
+	
 	return
 }
 
-func ParseCamera(s string) (camera *core.Camera) {
+func ParseCamera(s string) (camera *core.Camera, err error) {
 	cameraRE := regexp.MustCompile(`(?m)^\((-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+)\) \((-?[0-9]+\.?[0-9]*) (-?[0-9]+\.?[0-9]*) (-?[0-9]+\.?[0-9]*)\) ([0-9]+)$`)
 	index := cameraRE.FindStringSubmatch(s)
 	
@@ -84,6 +165,8 @@ func ParseCamera(s string) (camera *core.Camera) {
 		dir = geometry.NewVector(xDir, yDir, zDir)
 		
 		fov,_ = strconv.ParseFloat(index[7],64)
+	} else {
+		return nil, errors.New("no camera line : (x y z) (dx dy dz) fov")
 	}
 	
 	camera = core.NewCamera(*pos, *dir, fov)
@@ -91,7 +174,7 @@ func ParseCamera(s string) (camera *core.Camera) {
 	return
 }
 
-func ParseWorld(s string) (world *core.World) {
+func ParseWorld(s string) (world *core.World, err error) {
 	worldRE := regexp.MustCompile(`(?m)^\((-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+)\) \((-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+)\)$`)
 	index := worldRE.FindStringSubmatch(s)
 	
@@ -111,6 +194,8 @@ func ParseWorld(s string) (world *core.World) {
 		bGrd,_ = strconv.ParseFloat(index[6],64)
 		
 		groundReflexion = geometry.NewColor(rGrd, gGrd, bGrd)
+	} else {
+		return nil, errors.New("no sky and ground line : (sky r g b) (ground r g b)")
 	}
 	
 	world = core.NewWorld(*skyEmission, *groundReflexion)
@@ -118,7 +203,11 @@ func ParseWorld(s string) (world *core.World) {
 	return
 }
 
-func ParsePrimitives(s string) (prims []*geometry.Triangle) {
+/* triangles either give their diffuse color inline, or the name of a declared material :
+   Name (p1) (p2) (p3)  (diffuse) (emit)
+   Name (p1) (p2) (p3)  material (emit)
+   A material that isn't declared is an error naming the line */
+func ParsePrimitives(s string, materials map[string]geometry.Material) (prims []*geometry.Triangle, err error) {
 	trianglesRE := regexp.MustCompile(`(?m)^([A-Za-z]+) \((-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+)\) \((-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+)\) \((-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+)\)  \((-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+) (-?[0-9]+\.[0-9]+)\) \((-?[0-9]+\.?[0-9]*) (-?[0-9]+\.?[0-9]*) (-?[0-9]+\.?[0-9]*)\)$`)
 	
 	index2 := trianglesRE.FindAllStringSubmatch(s,-1)
@@ -163,7 +252,7 @@ func ParsePrimitives(s string) (prims []*geometry.Triangle) {
 			emit = geometry.NewColor(rEmit, gEmit, bEmit)
 			diffuse = geometry.NewColor(rDiffuse, gDiffuse, bDiffuse)
 			
-			p := geometry.NewTriangle(triangleID, p1, p2, p3, emit, diffuse)
+			p := geometry.NewTriangle(triangleID, p1, p2, p3, emit, geometry.NewLambertian(diffuse))
 			
 			if i == 0 {
 				prims[i] = p
@@ -174,5 +263,569 @@ func ParsePrimitives(s string) (prims []*geometry.Triangle) {
 		}
 	}
 	
+	namedRE := regexp.MustCompile(`(?m)^([A-Za-z]+) ` + tripleRE + ` ` + tripleRE + ` ` + tripleRE + `  ([A-Za-z]+) ` + tripleRE + `$`)
+	
+	for _,index := range namedRE.FindAllStringSubmatch(s,-1) {
+		material, ok := materials[index[11]]
+		if !ok {
+			return nil, fmt.Errorf("unknown material %s : %s", index[11], index[0])
+		}
+		p1 := geometry.NewPoint(parseTriple(index[2:5]))
+		p2 := geometry.NewPoint(parseTriple(index[5:8]))
+		p3 := geometry.NewPoint(parseTriple(index[8:11]))
+		emit := geometry.NewColor(parseTriple(index[12:15]))
+		prims = append(prims, geometry.NewTriangle(index[1], p1, p2, p3, emit, material))
+	}
+	
 	return
 }
+
+const numberRE = `(-?[0-9]+\.?[0-9]*)`
+const tripleRE = `\(` + numberRE + ` ` + numberRE + ` ` + numberRE + `\)`
+
+func parseTriple(values []string) (float64, float64, float64) {
+	x,_ := strconv.ParseFloat(values[0],64)
+	y,_ := strconv.ParseFloat(values[1],64)
+	z,_ := strconv.ParseFloat(values[2],64)
+	return x, y, z
+}
+
+/* lights without geometry :
+   point (x y z) (intensity)
+   spot (x y z) (direction) (intensity) innerAngle outerAngle
+   sun (direction the light travels) (irradiance) angularRadius
+   angles are in degrees */
+func ParseLights(s string) (lights []core.Light) {
+	pointRE := regexp.MustCompile(`(?m)^point ` + tripleRE + ` ` + tripleRE + `$`)
+	for _,index := range pointRE.FindAllStringSubmatch(s,-1) {
+		position := geometry.NewPoint(parseTriple(index[1:4]))
+		intensity := geometry.NewColor(parseTriple(index[4:7]))
+		lights = append(lights, core.NewPointLight(position, intensity))
+	}
+	
+	spotRE := regexp.MustCompile(`(?m)^spot ` + tripleRE + ` ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + ` ` + numberRE + `$`)
+	for _,index := range spotRE.FindAllStringSubmatch(s,-1) {
+		position := geometry.NewPoint(parseTriple(index[1:4]))
+		direction := geometry.NewVector(parseTriple(index[4:7]))
+		intensity := geometry.NewColor(parseTriple(index[7:10]))
+		inner,_ := strconv.ParseFloat(index[10],64)
+		outer,_ := strconv.ParseFloat(index[11],64)
+		lights = append(lights, core.NewSpotLight(position, direction, intensity, inner, outer))
+	}
+	
+	sunRE := regexp.MustCompile(`(?m)^sun ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + `$`)
+	for _,index := range sunRE.FindAllStringSubmatch(s,-1) {
+		direction := geometry.NewVector(parseTriple(index[1:4]))
+		irradiance := geometry.NewColor(parseTriple(index[4:7]))
+		radius,_ := strconv.ParseFloat(index[7],64)
+		lights = append(lights, core.NewDirectionalLight(direction, irradiance, radius))
+	}
+	
+	return
+}
+
+/* spectral power distributions :
+   spectrum name blackbody kelvins
+   spectrum name file path          "wavelength value" lines, wavelengths in nanometers
+   A file without any such line is an error naming the line */
+func ParseSpectra(s string) (map[string]geometry.Spectrum, error) {
+	spectra := make(map[string]geometry.Spectrum)
+	
+	blackbodyRE := regexp.MustCompile(`(?m)^spectrum ([A-Za-z]+) blackbody ` + numberRE + `$`)
+	for _,index := range blackbodyRE.FindAllStringSubmatch(s,-1) {
+		temperature,_ := strconv.ParseFloat(index[2],64)
+		spectra[index[1]] = geometry.NewBlackbody(temperature)
+	}
+	
+	fileRE := regexp.MustCompile(`(?m)^spectrum ([A-Za-z]+) file (\S+)$`)
+	for _,index := range fileRE.FindAllStringSubmatch(s,-1) {
+		spd := LoadSpectrum(index[2])
+		if spd == nil {
+			return nil, fmt.Errorf("can't read the spectrum %s : %s", index[2], index[0])
+		}
+		spectra[index[1]] = spd
+	}
+	
+	return spectra, nil
+}
+
+/* emission of the spectrum scaled to amount, given in unit over a light that sends
+   geometry times its luminance (or radiance) as flux : lumens and watts are the total flux,
+   the other units (nits, candela, lux, radiance) the luminance itself */
+func spectralEmission(spectrum geometry.Spectrum, unit string, amount float64, geometryFactor float64) *geometry.SpectralEmission {
+	switch unit {
+	case "lumens":
+		return geometry.NewPhotometricEmission(spectrum, amount/geometryFactor)
+	case "watts":
+		return geometry.NewRadiometricEmission(spectrum, amount/geometryFactor)
+	case "radiance":
+		return geometry.NewRadiometricEmission(spectrum, amount)
+	}
+	return geometry.NewPhotometricEmission(spectrum, amount)
+}
+
+/* spectral area lights, the triangles whose name starts with Prefix share the flux :
+   emitter Prefix spectrum lumens|watts total flux
+   emitter Prefix spectrum nits|radiance luminance (cd/m²) or radiance (W/(sr m²))
+   A spectrum that isn't declared is an error naming the line */
+func ParseSpectralEmitters(s string, prims []*geometry.Triangle, spectra map[string]geometry.Spectrum) error {
+	emitterRE := regexp.MustCompile(`(?m)^emitter ([A-Za-z]+) ([A-Za-z]+) (lumens|watts|nits|radiance) ` + numberRE + `$`)
+	for _,index := range emitterRE.FindAllStringSubmatch(s,-1) {
+		spectrum, ok := spectra[index[2]]
+		if !ok {
+			return fmt.Errorf("unknown spectrum %s : %s", index[2], index[0])
+		}
+		amount,_ := strconv.ParseFloat(index[4],64)
+		
+		var emitters []*geometry.Triangle
+		/* flux of a Lambertian emitter : pi times its area times its radiance */
+		geometryFactor := 0.0
+		for _,t := range prims {
+			if t != nil && strings.HasPrefix(t.Id(), index[1]) {
+				emitters = append(emitters, t)
+				sides := 1.0
+				if t.EmitSides() == geometry.EmitBoth {
+					sides = 2
+				}
+				geometryFactor += math.Pi * t.Area() * sides
+			}
+		}
+		if geometryFactor <= 0 {
+			continue
+		}
+		e := spectralEmission(spectrum, index[3], amount, geometryFactor)
+		for _,t := range emitters {
+			t.SetSpectralEmission(e)
+		}
+	}
+	return nil
+}
+
+/* lights without geometry and with a spectrum, amounts like for the emitters :
+   point (x y z) spectrum lumens|watts|candela amount
+   spot (x y z) (direction) spectrum lumens|watts|candela amount innerAngle outerAngle
+   sun (direction the light travels) spectrum lux|watts amount angularRadius      watts per m²
+   A spectrum that isn't declared is an error naming the line */
+func ParseSpectralLights(s string, spectra map[string]geometry.Spectrum) (lights []core.Light, err error) {
+	white := geometry.NewColor(1, 1, 1)
+	
+	pointRE := regexp.MustCompile(`(?m)^point ` + tripleRE + ` ([A-Za-z]+) (lumens|watts|candela) ` + numberRE + `$`)
+	for _,index := range pointRE.FindAllStringSubmatch(s,-1) {
+		spectrum, ok := spectra[index[4]]
+		if !ok {
+			return nil, fmt.Errorf("unknown spectrum %s : %s", index[4], index[0])
+		}
+		amount,_ := strconv.ParseFloat(index[6],64)
+		l := core.NewPointLight(geometry.NewPoint(parseTriple(index[1:4])), white)
+		/* white has a luminance of 1 : the power is the geometry factor */
+		l.SetSpectralEmission(spectralEmission(spectrum, index[5], amount, l.Power()))
+		lights = append(lights, l)
+	}
+	
+	spotRE := regexp.MustCompile(`(?m)^spot ` + tripleRE + ` ` + tripleRE + ` ([A-Za-z]+) (lumens|watts|candela) ` + numberRE + ` ` + numberRE + ` ` + numberRE + `$`)
+	for _,index := range spotRE.FindAllStringSubmatch(s,-1) {
+		spectrum, ok := spectra[index[7]]
+		if !ok {
+			return nil, fmt.Errorf("unknown spectrum %s : %s", index[7], index[0])
+		}
+		amount,_ := strconv.ParseFloat(index[9],64)
+		inner,_ := strconv.ParseFloat(index[10],64)
+		outer,_ := strconv.ParseFloat(index[11],64)
+		l := core.NewSpotLight(geometry.NewPoint(parseTriple(index[1:4])), geometry.NewVector(parseTriple(index[4:7])), white, inner, outer)
+		l.SetSpectralEmission(spectralEmission(spectrum, index[8], amount, l.Power()))
+		lights = append(lights, l)
+	}
+	
+	sunRE := regexp.MustCompile(`(?m)^sun ` + tripleRE + ` ([A-Za-z]+) (lux|watts) ` + numberRE + ` ` + numberRE + `$`)
+	for _,index := range sunRE.FindAllStringSubmatch(s,-1) {
+		spectrum, ok := spectra[index[4]]
+		if !ok {
+			return nil, fmt.Errorf("unknown spectrum %s : %s", index[4], index[0])
+		}
+		amount,_ := strconv.ParseFloat(index[6],64)
+		radius,_ := strconv.ParseFloat(index[7],64)
+		l := core.NewDirectionalLight(geometry.NewVector(parseTriple(index[1:4])), white, radius)
+		/* irradiance is the amount itself, whatever the unit */
+		if index[5] == "watts" {
+			l.SetSpectralEmission(geometry.NewRadiometricEmission(spectrum, amount))
+		} else {
+			l.SetSpectralEmission(geometry.NewPhotometricEmission(spectrum, amount))
+		}
+		lights = append(lights, l)
+	}
+	
+	return
+}
+
+/* named materials :
+   material name lambertian (reflectance)
+   material name lambertian texture
+   material name mirror (reflectance)
+   material name conductor (eta) (k) roughness
+   material name dielectric ior roughness [(transmittance)] [abbe V]   V disperses light in spectral mode
+   material name null */
+func ParseMaterials(s string, textures map[string]geometry.Texture) map[string]geometry.Material {
+	materials := make(map[string]geometry.Material)
+	
+	texturedRE := regexp.MustCompile(`(?m)^material ([A-Za-z]+) lambertian ([A-Za-z]+)$`)
+	for _,index := range texturedRE.FindAllStringSubmatch(s,-1) {
+		if texture, ok := textures[index[2]]; ok {
+			materials[index[1]] = geometry.NewTexturedLambertian(texture)
+		}
+	}
+	
+	lambertianRE := regexp.MustCompile(`(?m)^material ([A-Za-z]+) lambertian ` + tripleRE + `$`)
+	for _,index := range lambertianRE.FindAllStringSubmatch(s,-1) {
+		materials[index[1]] = geometry.NewLambertian(geometry.NewColor(parseTriple(index[2:5])))
+	}
+	
+	mirrorRE := regexp.MustCompile(`(?m)^material ([A-Za-z]+) mirror ` + tripleRE + `$`)
+	for _,index := range mirrorRE.FindAllStringSubmatch(s,-1) {
+		materials[index[1]] = geometry.NewMirror(geometry.NewColor(parseTriple(index[2:5])))
+	}
+	
+	conductorRE := regexp.MustCompile(`(?m)^material ([A-Za-z]+) conductor ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + `$`)
+	for _,index := range conductorRE.FindAllStringSubmatch(s,-1) {
+		eta := geometry.NewColor(parseTriple(index[2:5]))
+		k := geometry.NewColor(parseTriple(index[5:8]))
+		roughness,_ := strconv.ParseFloat(index[8],64)
+		materials[index[1]] = geometry.NewConductor(eta, k, roughness)
+	}
+	
+	nullRE := regexp.MustCompile(`(?m)^material ([A-Za-z]+) null$`)
+	for _,index := range nullRE.FindAllStringSubmatch(s,-1) {
+		materials[index[1]] = &geometry.NullMaterial{}
+	}
+	
+	dielectricRE := regexp.MustCompile(`(?m)^material ([A-Za-z]+) dielectric ` + numberRE + ` ` + numberRE + `(?: ` + tripleRE + `)?(?: abbe ` + numberRE + `)?$`)
+	for _,index := range dielectricRE.FindAllStringSubmatch(s,-1) {
+		ior,_ := strconv.ParseFloat(index[2],64)
+		roughness,_ := strconv.ParseFloat(index[3],64)
+		tint := geometry.NewColor(1, 1, 1)
+		if index[4] != "" {
+			tint = geometry.NewColor(parseTriple(index[4:7]))
+		}
+		dielectric := geometry.NewDielectric(ior, roughness, tint)
+		if index[7] != "" {
+			abbe,_ := strconv.ParseFloat(index[7],64)
+			dielectric.SetAbbe(abbe)
+		}
+		materials[index[1]] = dielectric
+	}
+	
+	return materials
+}
+
+/* textures :
+   texture name image path [repeat|clamp|mirror] [linear]
+                                                     PNG or JPEG, repeated by default, sRGB unless linear
+   texture name checker (even) (odd) scale           scale squares per unit of uv
+   texture name noise (low) (high) scale octaves     Perlin noise of the position */
+func ParseTextures(s string) (map[string]geometry.Texture, error) {
+	textures := make(map[string]geometry.Texture)
+	
+	imageRE := regexp.MustCompile(`(?m)^texture ([A-Za-z]+) image (\S+)(?: (repeat|clamp|mirror))?( linear)?$`)
+	for _,index := range imageRE.FindAllStringSubmatch(s,-1) {
+		img := LoadImage(index[2])
+		if img == nil {
+			return nil, fmt.Errorf("can't read the image %s : %s", index[2], index[0])
+		}
+		wrap := geometry.WrapRepeat
+		switch index[3] {
+		case "clamp":
+			wrap = geometry.WrapClamp
+		case "mirror":
+			wrap = geometry.WrapMirror
+		}
+		textures[index[1]] = geometry.NewImageTexture(img, wrap, index[4] == "")
+	}
+	
+	checkerRE := regexp.MustCompile(`(?m)^texture ([A-Za-z]+) checker ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + `$`)
+	for _,index := range checkerRE.FindAllStringSubmatch(s,-1) {
+		even := geometry.NewColor(parseTriple(index[2:5]))
+		odd := geometry.NewColor(parseTriple(index[5:8]))
+		scale,_ := strconv.ParseFloat(index[8],64)
+		textures[index[1]] = geometry.NewCheckerTexture(even, odd, scale)
+	}
+	
+	noiseRE := regexp.MustCompile(`(?m)^texture ([A-Za-z]+) noise ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + ` ([0-9]+)$`)
+	for _,index := range noiseRE.FindAllStringSubmatch(s,-1) {
+		low := geometry.NewColor(parseTriple(index[2:5]))
+		high := geometry.NewColor(parseTriple(index[5:8]))
+		scale,_ := strconv.ParseFloat(index[8],64)
+		octaves,_ := strconv.ParseInt(index[9],10,0)
+		textures[index[1]] = geometry.NewNoiseTexture(low, high, scale, int(octaves))
+	}
+	
+	return textures, nil
+}
+
+/* surface coordinates and textured emission of the triangles :
+   uv Name (u0 v0) (u1 v1) (u2 v2)    vertices of the triangle Name, (0 0) (1 0) (0 1) by default
+   emission Prefix texture            emission of the triangles whose name starts with Prefix
+   emitside Prefix front|back|both    faces of those triangles that emit, front (along the normal) by default
+   A texture that isn't declared is an error naming the line */
+func ParseTextureCoordinates(s string, prims []*geometry.Triangle, textures map[string]geometry.Texture) error {
+	pairRE := `\(` + numberRE + ` ` + numberRE + `\)`
+	uvRE := regexp.MustCompile(`(?m)^uv ([A-Za-z]+) ` + pairRE + ` ` + pairRE + ` ` + pairRE + `$`)
+	for _,index := range uvRE.FindAllStringSubmatch(s,-1) {
+		var uv [3]*geometry.UV
+		for i := range uv {
+			u,_ := strconv.ParseFloat(index[2+2*i],64)
+			v,_ := strconv.ParseFloat(index[3+2*i],64)
+			uv[i] = geometry.NewUV(u, v)
+		}
+		for _,t := range prims {
+			if t != nil && t.Id() == index[1] {
+				t.SetUV(uv[0], uv[1], uv[2])
+			}
+		}
+	}
+	
+	emissionRE := regexp.MustCompile(`(?m)^emission ([A-Za-z]+) ([A-Za-z]+)$`)
+	for _,index := range emissionRE.FindAllStringSubmatch(s,-1) {
+		texture, ok := textures[index[2]]
+		if !ok {
+			return fmt.Errorf("unknown texture %s : %s", index[2], index[0])
+		}
+		for _,t := range prims {
+			if t != nil && strings.HasPrefix(t.Id(), index[1]) {
+				t.SetEmitTexture(texture)
+			}
+		}
+	}
+	
+	sidesRE := regexp.MustCompile(`(?m)^emitside ([A-Za-z]+) (front|back|both)$`)
+	for _,index := range sidesRE.FindAllStringSubmatch(s,-1) {
+		sides := geometry.EmitFront
+		switch index[2] {
+		case "back":
+			sides = geometry.EmitBack
+		case "both":
+			sides = geometry.EmitBoth
+		}
+		for _,t := range prims {
+			if t != nil && strings.HasPrefix(t.Id(), index[1]) {
+				t.SetEmitSides(sides)
+			}
+		}
+	}
+	return nil
+}
+
+/* perturbed shading normals of the triangles whose name starts with Prefix :
+   normalmap Prefix texture          tangent space normal map, better declared linear
+   bump Prefix texture scale         height map, scale meters for a texture luminance of 1
+   A texture that isn't declared is an error naming the line */
+func ParseShadingNormals(s string, prims []*geometry.Triangle, textures map[string]geometry.Texture) error {
+	normalRE := regexp.MustCompile(`(?m)^normalmap ([A-Za-z]+) ([A-Za-z]+)$`)
+	for _,index := range normalRE.FindAllStringSubmatch(s,-1) {
+		texture, ok := textures[index[2]]
+		if !ok {
+			return fmt.Errorf("unknown texture %s : %s", index[2], index[0])
+		}
+		for _,t := range prims {
+			if t != nil && strings.HasPrefix(t.Id(), index[1]) {
+				t.SetNormalMap(texture)
+			}
+		}
+	}
+	
+	bumpRE := regexp.MustCompile(`(?m)^bump ([A-Za-z]+) ([A-Za-z]+) ` + numberRE + `$`)
+	for _,index := range bumpRE.FindAllStringSubmatch(s,-1) {
+		texture, ok := textures[index[2]]
+		if !ok {
+			return fmt.Errorf("unknown texture %s : %s", index[2], index[0])
+		}
+		scale,_ := strconv.ParseFloat(index[3],64)
+		for _,t := range prims {
+			if t != nil && strings.HasPrefix(t.Id(), index[1]) {
+				t.SetBumpMap(texture, scale)
+			}
+		}
+	}
+	return nil
+}
+
+/* homogeneous media :
+   medium name (sigmaA) (sigmaS) g
+   fog name                  fills the whole scene
+   inside name Prefix        fills the closed mesh made of the triangles whose name starts with Prefix
+   A medium that isn't declared is an error naming the line */
+func ParseMedia(s string, scene *core.Scene, prims []*geometry.Triangle) error {
+	media := make(map[string]*geometry.Medium)
+	
+	mediumRE := regexp.MustCompile(`(?m)^medium ([A-Za-z]+) ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + `$`)
+	for _,index := range mediumRE.FindAllStringSubmatch(s,-1) {
+		sigmaA := geometry.NewColor(parseTriple(index[2:5]))
+		sigmaS := geometry.NewColor(parseTriple(index[5:8]))
+		g,_ := strconv.ParseFloat(index[8],64)
+		media[index[1]] = geometry.NewMedium(sigmaA, sigmaS, g)
+	}
+	
+	fogRE := regexp.MustCompile(`(?m)^fog ([A-Za-z]+)$`)
+	if index := fogRE.FindStringSubmatch(s); len(index) > 1 {
+		m, ok := media[index[1]]
+		if !ok {
+			return fmt.Errorf("unknown medium %s : %s", index[1], index[0])
+		}
+		scene.SetMedium(m)
+	}
+	
+	insideRE := regexp.MustCompile(`(?m)^inside ([A-Za-z]+) ([A-Za-z]+)$`)
+	for _,index := range insideRE.FindAllStringSubmatch(s,-1) {
+		m, ok := media[index[1]]
+		if !ok {
+			return fmt.Errorf("unknown medium %s : %s", index[1], index[0])
+		}
+		for _,t := range prims {
+			if t != nil && strings.HasPrefix(t.Id(), index[2]) {
+				t.SetInterior(m)
+			}
+		}
+	}
+	return nil
+}
+
+/* crop window "x0,y0,x1,y1" of an image of that size : pixels, x1 and y1 excluded, or fractions
+   of the image when every bound is within [0,1] and one of them has a decimal point */
+func ParseCropWindow(s string, width int, height int) (*core.CropWindow, error) {
+	cropRE := regexp.MustCompile(`^\s*([0-9]+\.?[0-9]*)\s*,\s*([0-9]+\.?[0-9]*)\s*,\s*([0-9]+\.?[0-9]*)\s*,\s*([0-9]+\.?[0-9]*)\s*$`)
+	m := cropRE.FindStringSubmatch(s)
+	if m == nil {
+		return nil, errors.New("expected x0,y0,x1,y1 : " + s)
+	}
+	var v [4]float64
+	normalized := strings.Contains(s, ".")
+	for i := range v {
+		v[i], _ = strconv.ParseFloat(m[i+1], 64)
+		normalized = normalized && v[i] <= 1
+	}
+	if v[2] <= v[0] || v[3] <= v[1] {
+		return nil, errors.New("empty crop window : " + s)
+	}
+	if normalized {
+		return core.NewNormalizedCropWindow(v[0], v[1], v[2], v[3], width, height), nil
+	}
+	return core.NewCropWindow(int(v[0]), int(v[1]), int(v[2]), int(v[3])), nil
+}
+
+/* keyframes, the interpolation being the one toward the next key (linear by default) :
+   camerakey frame (position) (direction) fov [linear|catmullrom]
+   objectkey Prefix frame (translation) (rotation) scale [linear|catmullrom]
+   rotations in degrees around x, then y, then z, rotation and scale around the center of the
+   triangles whose name starts with Prefix, the longest one when several match. nil when the
+   scene has no key */
+func ParseAnimation(s string, prims []*geometry.Triangle) *core.Animation {
+	interpolationRE := `(?: (linear|catmullrom))?$`
+	interpolation := func(name string) int {
+		if name == "catmullrom" {
+			return core.CatmullRomInterpolation
+		}
+		return core.LinearInterpolation
+	}
+	animation := core.NewAnimation()
+	keys := 0
+	
+	cameraRE := regexp.MustCompile(`(?m)^camerakey ` + numberRE + ` ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + interpolationRE)
+	for _,index := range cameraRE.FindAllStringSubmatch(s,-1) {
+		frame,_ := strconv.ParseFloat(index[1],64)
+		position := geometry.NewPoint(parseTriple(index[2:5]))
+		direction := geometry.NewVector(parseTriple(index[5:8]))
+		fov,_ := strconv.ParseFloat(index[8],64)
+		animation.AddCameraKey(frame, *position, *direction, fov, interpolation(index[9]))
+		keys++
+	}
+	
+	objectRE := regexp.MustCompile(`(?m)^objectkey ([A-Za-z]+) ` + numberRE + ` ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + interpolationRE)
+	objectKeys := objectRE.FindAllStringSubmatch(s,-1)
+	
+	/* a triangle belongs to the longest prefix it starts with : B and Bi are two objects */
+	members := make(map[string][]*geometry.Triangle)
+	for _,t := range prims {
+		if t == nil {
+			continue
+		}
+		owner := ""
+		for _,index := range objectKeys {
+			if strings.HasPrefix(t.Id(), index[1]) && len(index[1]) > len(owner) {
+				owner = index[1]
+			}
+		}
+		if owner != "" {
+			members[owner] = append(members[owner], t)
+		}
+	}
+	
+	for _,index := range objectKeys {
+		triangles := members[index[1]]
+		if len(triangles) == 0 {
+			continue
+		}
+		frame,_ := strconv.ParseFloat(index[2],64)
+		translation := geometry.NewVector(parseTriple(index[3:6]))
+		rotation := geometry.NewVector(parseTriple(index[6:9]))
+		scale,_ := strconv.ParseFloat(index[9],64)
+		animation.AddObjectKey(index[1], triangles, frame, *translation, *rotation, scale, interpolation(index[10]))
+		keys++
+	}
+	
+	if keys == 0 {
+		return nil
+	}
+	return animation
+}
+
+/* named views, rigs being built on a named camera or on main, the camera line :
+   camera Name (position) (direction) fov
+   stereo Name Camera interocular convergence     views Name_left and Name_right
+   turntable Name Camera (center) views            views Name_000, Name_001...
+   A view line that doesn't parse, or builds on an unknown camera, is an error */
+func ParseViews(s string, scene *core.Scene, main *core.Camera) error {
+	cameras := map[string]*core.Camera{"main": main}
+	
+	cameraRE := regexp.MustCompile(`(?m)^camera ` + viewNameRE + ` ` + tripleRE + ` ` + tripleRE + ` ` + numberRE + `$`)
+	stereoRE := regexp.MustCompile(`(?m)^stereo ` + viewNameRE + ` ` + viewNameRE + ` ` + numberRE + ` ` + numberRE + `$`)
+	turntableRE := regexp.MustCompile(`(?m)^turntable ` + viewNameRE + ` ` + viewNameRE + ` ` + tripleRE + ` ([0-9]+)$`)
+	for _,line := range strings.Split(s, "\n") {
+		for prefix, re := range map[string]*regexp.Regexp{"camera ": cameraRE, "stereo ": stereoRE, "turntable ": turntableRE} {
+			if strings.HasPrefix(line, prefix) && !re.MatchString(line) {
+				return errors.New("invalid view : " + line)
+			}
+		}
+	}
+	
+	for _,index := range cameraRE.FindAllStringSubmatch(s,-1) {
+		fov,_ := strconv.ParseFloat(index[8],64)
+		camera := core.NewCamera(*geometry.NewPoint(parseTriple(index[2:5])), *geometry.NewVector(parseTriple(index[5:8])), fov)
+		cameras[index[1]] = camera
+		scene.AddView(index[1], camera)
+	}
+	
+	for _,index := range stereoRE.FindAllStringSubmatch(s,-1) {
+		camera, ok := cameras[index[2]]
+		if !ok {
+			return fmt.Errorf("unknown camera %s : %s", index[2], index[0])
+		}
+		interocular,_ := strconv.ParseFloat(index[3],64)
+		convergence,_ := strconv.ParseFloat(index[4],64)
+		left, right := core.NewStereoPair(camera, interocular, convergence)
+		scene.AddView(index[1] + "_left", left)
+		scene.AddView(index[1] + "_right", right)
+	}
+	
+	for _,index := range turntableRE.FindAllStringSubmatch(s,-1) {
+		camera, ok := cameras[index[2]]
+		if !ok {
+			return fmt.Errorf("unknown camera %s : %s", index[2], index[0])
+		}
+		views,_ := strconv.Atoi(index[6])
+		for i, view := range core.NewTurntable(camera, *geometry.NewPoint(parseTriple(index[3:6])), views) {
+			scene.AddView(fmt.Sprintf("%s_%03d", index[1], i), view)
+		}
+	}
+	return nil
+}
+
+/* names of the views : letters, digits and underscores */
+const viewNameRE = `([A-Za-z0-9_]+)`
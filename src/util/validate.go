@@ -0,0 +1,103 @@
+package util
+
+import (
+	"core"
+	"fmt"
+	"geometry"
+	"math"
+)
+
+/* distance under which a vertex is taken as lying in the plane of an emitter */
+const planeTolerance float64 = 1e-6
+
+/* height of a triangle over its longest edge under which it is a sliver */
+const slivered float64 = 1e-6
+
+/* warnings about emitters that light nothing : every other triangle lies behind
+   the faces they emit from, most of the time a flipped winding */
+func ValidateEmitters(prims []*geometry.Triangle) (warnings []string) {
+	for _,e := range prims {
+		if e == nil || !geometry.IsLight(e) {
+			continue
+		}
+		if !facesAnySurface(e, prims) {
+			warnings = append(warnings, fmt.Sprintf("emitter %s faces away from every other surface (flipped winding ? see emitside)", e.Id()))
+		}
+	}
+	return
+}
+
+func facesAnySurface(e *geometry.Triangle, prims []*geometry.Triangle) bool {
+	origin := e.Vertices()[0]
+	normal := e.Normal()
+	for _,t := range prims {
+		if t == nil || t == e {
+			continue
+		}
+		for _,v := range t.Vertices() {
+			d := geometry.NewVectorFromPoints(origin, v).DotProduct(normal)
+			switch e.EmitSides() {
+			case geometry.EmitFront:
+				if d > planeTolerance {
+					return true
+				}
+			case geometry.EmitBack:
+				if d < -planeTolerance {
+					return true
+				}
+			default:
+				if d > planeTolerance || d < -planeTolerance {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+/* warnings about triangles that can't be rendered : no area, hence no normal, or so thin
+   next to their longest edge that their normal is mostly rounding error */
+func ValidateGeometry(prims []*geometry.Triangle) (warnings []string) {
+	for _,t := range prims {
+		if t == nil {
+			continue
+		}
+		v := t.Vertices()
+		longest2 := 0.0
+		for i := range v {
+			edge := geometry.NewVectorFromPoints(v[i], v[(i+1)%3])
+			longest2 = math.Max(longest2, edge.DotProduct(*edge))
+		}
+		if !(t.Area() > 0) {
+			warnings = append(warnings, fmt.Sprintf("triangle %s is degenerate (zero area), it has no normal", t.Id()))
+		} else if 2*t.Area() < slivered*longest2 {
+			warnings = append(warnings, fmt.Sprintf("triangle %s is a sliver (height %.3g of its longest edge), its normal is unreliable", t.Id(), 2*t.Area()/longest2))
+		}
+	}
+	return
+}
+
+/* warnings about cameras that see nothing of the scene : outside its bounds and looking away.
+   A camera outside looking in, as in front of an open box, is fine */
+func ValidateCameras(scene *core.Scene) (warnings []string) {
+	box := scene.Enveloppe()
+	names := append([]string{"main"}, scene.Views()...)
+	cameras := scene.Cameras()
+	for _,name := range names {
+		p := cameras[name].Position()
+		inside := true
+		for axis,c := range []float64{p.X(), p.Y(), p.Z()} {
+			inside = inside && c >= box.GetLowerFromAxis(axis) && c <= box.GetUpperFromAxis(axis)
+		}
+		if inside {
+			continue
+		}
+		/* the slab test hits the box behind the ray too, its far side must lie ahead */
+		hits := geometry.RayIntersectsPrimitive(geometry.NewRay(p, cameras[name].Direction()), box)
+		if geometry.IsHit(hits) && hits[len(hits)-1].Dist() >= 0 {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("camera %s at (%g %g %g) is outside the scene and looks away from it", name, p.X(), p.Y(), p.Z()))
+	}
+	return
+}